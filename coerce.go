@@ -0,0 +1,124 @@
+package structs
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// coerce converts the scalar val to the type as, one of "string", "int",
+// "float" or "bool", ie: for `structs:"price,as=string"`. Strings are
+// parsed, numbers are formatted, bools convert to and from 1 and 0, and
+// fmt.Stringer values convert to strings. Nil values are kept as is. An
+// error is returned if val can't be converted, ie: "abc" to int or 1.5 to
+// int.
+func coerce(val interface{}, as string) (interface{}, error) {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return val, nil
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return val, nil
+	}
+
+	fail := func(err error) (interface{}, error) {
+		if err == nil {
+			err = fmt.Errorf("cannot convert %s to %s", v.Type(), as)
+		}
+		return nil, err
+	}
+
+	switch as {
+	case "string":
+		switch {
+		case v.Kind() == reflect.String:
+			return v.String(), nil
+		case v.Kind() == reflect.Bool:
+			return strconv.FormatBool(v.Bool()), nil
+		case isInt(v.Kind()):
+			return strconv.FormatInt(v.Int(), 10), nil
+		case isUint(v.Kind()):
+			return strconv.FormatUint(v.Uint(), 10), nil
+		case v.Kind() == reflect.Float32:
+			return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+		case v.Kind() == reflect.Float64:
+			return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+		}
+
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+	case "int":
+		switch {
+		case v.Kind() == reflect.String:
+			i, err := strconv.Atoi(v.String())
+			if err != nil {
+				return fail(err)
+			}
+			return i, nil
+		case v.Kind() == reflect.Bool:
+			if v.Bool() {
+				return 1, nil
+			}
+			return 0, nil
+		case isInt(v.Kind()):
+			if i := v.Int(); i >= math.MinInt && i <= math.MaxInt {
+				return int(i), nil
+			}
+		case isUint(v.Kind()):
+			if u := v.Uint(); u <= math.MaxInt {
+				return int(u), nil
+			}
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			if f := v.Float(); f == math.Trunc(f) && f >= math.MinInt && f < math.MaxInt {
+				return int(f), nil
+			}
+		}
+	case "float":
+		switch {
+		case v.Kind() == reflect.String:
+			f, err := strconv.ParseFloat(v.String(), 64)
+			if err != nil {
+				return fail(err)
+			}
+			return f, nil
+		case v.Kind() == reflect.Bool:
+			if v.Bool() {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		case isInt(v.Kind()):
+			return float64(v.Int()), nil
+		case isUint(v.Kind()):
+			return float64(v.Uint()), nil
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			return v.Float(), nil
+		}
+	case "bool":
+		switch {
+		case v.Kind() == reflect.String:
+			b, err := strconv.ParseBool(v.String())
+			if err != nil {
+				return fail(err)
+			}
+			return b, nil
+		case v.Kind() == reflect.Bool:
+			return v.Bool(), nil
+		case isInt(v.Kind()):
+			return v.Int() != 0, nil
+		case isUint(v.Kind()):
+			return v.Uint() != 0, nil
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			return v.Float() != 0, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", as)
+	}
+
+	return fail(nil)
+}
@@ -0,0 +1,104 @@
+package structs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMap_AsOption(t *testing.T) {
+	type product struct {
+		Price    int     `structs:"price,as=string"`
+		Quantity string  `structs:"quantity,as=int"`
+		Weight   string  `structs:"weight,as=float"`
+		Active   int     `structs:"active,as=bool"`
+		Ratio    float32 `structs:"ratio,as=string"`
+		Missing  *int    `structs:"missing,as=string"`
+	}
+
+	p := product{Price: 42, Quantity: "7", Weight: "1.5", Active: 1, Ratio: 0.1}
+
+	expected := map[string]interface{}{
+		"price":    "42",
+		"quantity": 7,
+		"weight":   1.5,
+		"active":   true,
+		"ratio":    "0.1",
+		"missing":  (*int)(nil),
+	}
+
+	m, err := New(p).MapE()
+	if err != nil {
+		t.Fatalf("MapE should not return an error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapE should coerce the values, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMapE_AsOptionError(t *testing.T) {
+	type B struct {
+		Count string `structs:"count,as=int"`
+	}
+
+	type A struct {
+		Name  string `structs:"name,as=bool"`
+		Ratio string `structs:"ratio,as=decimal"`
+		B     B      `structs:"b"`
+	}
+
+	a := A{Name: "example", Ratio: "0.5", B: B{Count: "1.5"}}
+
+	_, err := New(a).MapE()
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("MapE should return a *FieldError, got: %v", err)
+	}
+
+	expected := `name (Name): strconv.ParseBool: parsing "example": invalid syntax
+ratio (Ratio): unknown type "decimal"
+b.count (Count): strconv.Atoi: parsing "1.5": invalid syntax`
+	if err.Error() != expected {
+		t.Errorf("MapE should return %q, got: %q", expected, err)
+	}
+
+	if m := Map(a); m["name"] != "example" {
+		t.Errorf("Map should keep values which can't be coerced, got: %v", m["name"])
+	}
+}
+
+func TestMapE_AsOptionEmittedFields(t *testing.T) {
+	type Item struct {
+		Count string `structs:"count,as=int"`
+	}
+
+	type A struct {
+		Empty  string          `structs:"empty,omitempty,as=int"`
+		Hidden string          `structs:"hidden,as=int"`
+		Items  []Item          `structs:"items"`
+		ByName map[string]Item `structs:"by_name"`
+	}
+
+	a := A{Hidden: "x", Items: []Item{{Count: "1"}, {Count: "two"}}, ByName: map[string]Item{"a": {Count: "three"}}}
+
+	s := New(a)
+	s.IncludeFunc = func(ctx context.Context, f *Field) bool { return f.Name() != "Hidden" }
+
+	_, err := s.MapE()
+
+	expected := `items.1.count (Count): strconv.Atoi: parsing "two": invalid syntax
+by_name.a.count (Count): strconv.Atoi: parsing "three": invalid syntax`
+	if err == nil || err.Error() != expected {
+		t.Errorf("MapE should only check the emitted fields, including the structs in slices and maps, expected %q, got: %v", expected, err)
+	}
+
+	a.Items[1].Count = "2"
+	a.ByName["a"] = Item{Count: "3"}
+
+	if _, err := s.MapE(); err != nil {
+		t.Errorf("MapE should not return an error for omitted fields, got: %v", err)
+	}
+}
@@ -0,0 +1,454 @@
+package structs
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NumberCoercion is the policy for setting numbers into fields of a
+// different numeric type with Decode, ie: a float64 decoded from JSON into
+// an int field.
+type NumberCoercion int
+
+const (
+	// NumberStrict only sets numbers which are represented exactly by the
+	// field's type, ie: float64(3) into an int field, but not float64(3.5)
+	// or 300 into an int8 field.
+	NumberStrict NumberCoercion = iota
+
+	// NumberLossy sets all numbers, truncating fractions and overflowing
+	// values as a Go conversion does.
+	NumberLossy
+)
+
+// Decode sets the fields of the struct from the given map, which is keyed
+// the same way as the output of Map. Keys without a field are ignored and
+// fields without a key are left untouched. Fields tagged with the alias
+// option, ie: `structs:"name,alias=old;legacy"`, are decoded from the first
+// alias present if their key is absent. Fields tagged with readonly, ie:
+// server managed IDs, are never set. Nested maps are decoded into
+// nested structs, allocating nil pointers as needed, and the fields of
+// flattened structs are decoded from the same map. Values must be
+// assignable to the field's type, except for numbers, which are converted
+// according to NumberCoercion, and []interface{} and map[string]interface{}
+// values, which are decoded element by element. time.Time fields are
+// decoded from strings parsed with TimeFormat and from numbers as unix
+// timestamps in seconds. The *Struct must be created with a pointer,
+// otherwise ErrNotSettable is returned. Errors of fields are returned as a
+// *FieldError.
+func (s *Struct) Decode(m map[string]interface{}) error {
+	if !s.value.CanSet() {
+		return ErrNotSettable
+	}
+
+	for _, field := range s.structFields() {
+		val := s.value.FieldByIndex(field.Index)
+		key := s.fieldKey(field)
+		_, tagOpts := s.parseTag(field)
+
+		if tagOpts.Has("readonly") {
+			continue
+		}
+
+		if s.flattens(field, val, tagOpts) {
+			if err := s.decodeFlattened(val, m); err != nil {
+				return err
+			}
+			continue
+		}
+
+		src, ok := m[key]
+		if !ok {
+			src, ok = lookupAlias(m, tagOpts)
+		}
+		if !ok {
+			continue
+		}
+
+		if err := s.decode(val, src); err != nil {
+			return fieldError(field, key, err)
+		}
+	}
+
+	return nil
+}
+
+// decodeFlattened decodes the flattened struct, or pointer to struct, val
+// from m. Nil pointers are only allocated if any of the struct's fields is
+// set, as Map emits them under their own key.
+func (s *Struct) decodeFlattened(val reflect.Value, m map[string]interface{}) error {
+	if val.Kind() != reflect.Ptr {
+		return s.sub(val.Addr().Interface()).Decode(m)
+	}
+
+	if !val.IsNil() {
+		return s.sub(val.Interface()).Decode(m)
+	}
+
+	n := reflect.New(val.Type().Elem())
+	if err := s.sub(n.Interface()).Decode(m); err != nil {
+		return err
+	}
+
+	if !n.Elem().IsZero() {
+		val.Set(n)
+	}
+	return nil
+}
+
+// ApplyPatch sets the fields whose keys are present in patch, ie: for an
+// HTTP PATCH, and returns the keys of the fields whose value changed, in
+// declaration order. Values are decoded as with Decode, so nested maps only
+// set the keys they contain and fields tagged with readonly are ignored.
+// Keys without a field are ignored, or with Strict an error wrapping
+// ErrFieldNotFound is returned before any field is set. An error is returned
+// for values which can't be decoded, in which case the fields before it may
+// already be set. The *Struct must be created with a pointer, otherwise
+// ErrNotSettable is returned.
+func (s *Struct) ApplyPatch(patch map[string]interface{}) ([]string, error) {
+	if !s.value.CanSet() {
+		return nil, ErrNotSettable
+	}
+
+	fields := s.structFields()
+
+	if s.Strict {
+		keys := make(map[string]bool, len(fields))
+		for _, field := range fields {
+			keys[s.fieldKey(field)] = true
+		}
+
+		for key := range patch {
+			if !keys[key] {
+				return nil, fmt.Errorf("%w: %s", ErrFieldNotFound, key)
+			}
+		}
+	}
+
+	var changed []string
+	for _, field := range fields {
+		key := s.fieldKey(field)
+		src, ok := patch[key]
+		if _, tagOpts := s.parseTag(field); !ok || tagOpts.Has("readonly") {
+			continue
+		}
+
+		val := s.value.FieldByIndex(field.Index)
+		before := deepCopy(val, make(map[uintptr]reflect.Value))
+
+		if err := s.decode(val, src); err != nil {
+			return changed, fieldError(field, key, err)
+		}
+
+		if !reflect.DeepEqual(before.Interface(), val.Interface()) {
+			changed = append(changed, key)
+		}
+	}
+
+	return changed, nil
+}
+
+// deepCopy returns a copy of v which shares no pointers, slices or maps
+// with it, except for unexported fields. copies holds the copies of the
+// pointers seen so far, so cyclic values are copied once.
+func deepCopy(v reflect.Value, copies map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		if c, ok := copies[v.Pointer()]; ok {
+			return c
+		}
+
+		c := reflect.New(v.Type().Elem())
+		copies[v.Pointer()] = c
+		c.Elem().Set(deepCopy(v.Elem(), copies))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), copies))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i), copies))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copies))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, deepCopy(v.MapIndex(k), copies))
+		}
+		return c
+	}
+
+	c := reflect.New(v.Type()).Elem()
+	c.Set(v)
+	return c
+}
+
+// lookupAlias returns the value of the first key of the alias tag option
+// found in m. Aliases are separated by ';', ie: "alias=old;legacy".
+func lookupAlias(m map[string]interface{}, tagOpts tagOptions) (interface{}, bool) {
+	aliases, ok := tagOpts.Get("alias")
+	if !ok {
+		return nil, false
+	}
+
+	for _, alias := range strings.Split(aliases, ";") {
+		if src, ok := m[alias]; ok {
+			return src, true
+		}
+	}
+
+	return nil, false
+}
+
+// decode sets dst to the value src.
+func (s *Struct) decode(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(src)
+	if v.Type().AssignableTo(dst.Type()) {
+		dst.Set(v)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return s.decode(dst.Elem(), src)
+	case reflect.Struct:
+		if dst.Type() == timeType && (v.Kind() == reflect.String || isNumber(v.Kind())) {
+			return s.decodeTime(dst, v)
+		}
+
+		if m, ok := src.(map[string]interface{}); ok {
+			return s.sub(dst.Addr().Interface()).Decode(m)
+		}
+	case reflect.Slice:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			slice := reflect.MakeSlice(dst.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				if err := s.decode(slice.Index(i), v.Index(i).Interface()); err != nil {
+					return elemError(strconv.Itoa(i), err)
+				}
+			}
+			dst.Set(slice)
+			return nil
+		}
+	case reflect.Map:
+		if v.Kind() == reflect.Map && v.Type().Key().AssignableTo(dst.Type().Key()) {
+			m := reflect.MakeMapWithSize(dst.Type(), v.Len())
+			for _, k := range v.MapKeys() {
+				elem := reflect.New(dst.Type().Elem()).Elem()
+				if err := s.decode(elem, v.MapIndex(k).Interface()); err != nil {
+					return elemError(fmt.Sprint(k.Interface()), err)
+				}
+				m.SetMapIndex(k, elem)
+			}
+			dst.Set(m)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if isNumber(v.Kind()) {
+			return s.decodeNumber(dst, v)
+		}
+	}
+
+	// named types of the same kind, ie: a string into a `type Name string`
+	if v.Kind() == dst.Kind() && v.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(v.Convert(dst.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("cannot decode %s into %s", v.Type(), dst.Type())
+}
+
+// fieldError returns the error of decoding the field from key as a
+// *FieldError. Errors of slice elements and map values, which are not
+// fields themselves, are reported with the field's GoName and Key.
+func fieldError(field reflect.StructField, key string, err error) error {
+	fe, ok := err.(*FieldError)
+	if !ok {
+		return &FieldError{Path: key, GoName: field.Name, Key: key, Err: err}
+	}
+
+	if fe.GoName == "" {
+		n := *fe
+		n.GoName, n.Key = field.Name, key
+		fe = &n
+	}
+	return withPrefix(key, fe)
+}
+
+// elemError returns the error of decoding the slice element or map value
+// at index as a *FieldError whose Path starts with index, ie: "1".
+func elemError(index string, err error) error {
+	if _, ok := err.(*FieldError); ok {
+		return withPrefix(index, err)
+	}
+	return &FieldError{Path: index, Err: err}
+}
+
+// decodeTime sets the time.Time dst to the string v parsed with TimeFormat,
+// or to the number v as a unix timestamp in seconds. Times are in
+// TimeLocation if set, and in UTC otherwise.
+func (s *Struct) decodeTime(dst, v reflect.Value) error {
+	loc := s.TimeLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var t time.Time
+	switch {
+	case v.Kind() == reflect.String:
+		layout := s.TimeFormat
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+
+		var err error
+		if t, err = time.ParseInLocation(layout, v.String(), loc); err != nil {
+			return err
+		}
+	case isInt(v.Kind()):
+		t = time.Unix(v.Int(), 0)
+	case isUint(v.Kind()):
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("%v is out of range for a unix timestamp", v.Interface())
+		}
+		t = time.Unix(int64(v.Uint()), 0)
+	default:
+		sec, frac := math.Modf(v.Float())
+		t = time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+	}
+
+	dst.Set(reflect.ValueOf(t.In(loc)))
+	return nil
+}
+
+// decodeNumber sets the numeric dst to the number v according to the
+// NumberCoercion policy of s.
+func (s *Struct) decodeNumber(dst, v reflect.Value) error {
+	strict := s.NumberCoercion == NumberStrict
+	lossErr := fmt.Errorf("%v can't be represented exactly by %s", v.Interface(), dst.Type())
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch {
+		case isInt(v.Kind()):
+			i = v.Int()
+		case isUint(v.Kind()):
+			if strict && v.Uint() > math.MaxInt64 {
+				return lossErr
+			}
+			i = int64(v.Uint())
+		default:
+			f := v.Float()
+			if strict && (f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64) {
+				return lossErr
+			}
+			i = int64(f)
+		}
+
+		if strict && dst.OverflowInt(i) {
+			return lossErr
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch {
+		case isInt(v.Kind()):
+			if strict && v.Int() < 0 {
+				return lossErr
+			}
+			u = uint64(v.Int())
+		case isUint(v.Kind()):
+			u = v.Uint()
+		default:
+			f := v.Float()
+			if strict && (f != math.Trunc(f) || f < 0 || f >= math.MaxUint64) {
+				return lossErr
+			}
+			u = uint64(f)
+		}
+
+		if strict && dst.OverflowUint(u) {
+			return lossErr
+		}
+		dst.SetUint(u)
+	default:
+		var f float64
+		switch {
+		case isInt(v.Kind()):
+			f = float64(v.Int())
+		case isUint(v.Kind()):
+			f = float64(v.Uint())
+		default:
+			f = v.Float()
+		}
+
+		if strict && dst.OverflowFloat(f) {
+			return lossErr
+		}
+		dst.SetFloat(f)
+	}
+
+	return nil
+}
+
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNumber(k reflect.Kind) bool {
+	return isInt(k) || isUint(k) || k == reflect.Float32 || k == reflect.Float64
+}
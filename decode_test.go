@@ -0,0 +1,451 @@
+package structs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	type address struct {
+		City string `structs:"city"`
+		Zip  int    `structs:"zip"`
+	}
+
+	type name string
+
+	type user struct {
+		Name    name              `structs:"name"`
+		Age     int               `structs:"age"`
+		Address *address          `structs:"address"`
+		Others  []address         `structs:"others"`
+		Tags    []string          `structs:"tags"`
+		Attrs   map[string]int    `structs:"attrs"`
+		Skip    string            `structs:"-"`
+		Kept    string            `structs:"kept"`
+		Raw     map[string]string `structs:"raw"`
+	}
+
+	u := &user{Kept: "kept"}
+
+	err := New(u).Decode(map[string]interface{}{
+		"name":    "example",
+		"age":     float64(30),
+		"address": map[string]interface{}{"city": "Istanbul", "zip": float64(34000)},
+		"others":  []interface{}{map[string]interface{}{"city": "Ankara"}},
+		"tags":    []interface{}{"a", "b"},
+		"attrs":   map[string]interface{}{"a": float64(1)},
+		"Skip":    "skip",
+		"-":       "skip",
+		"unknown": true,
+		"raw":     map[string]string{"a": "b"},
+	})
+	if err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	expected := &user{
+		Name:    "example",
+		Age:     30,
+		Address: &address{City: "Istanbul", Zip: 34000},
+		Others:  []address{{City: "Ankara"}},
+		Tags:    []string{"a", "b"},
+		Attrs:   map[string]int{"a": 1},
+		Kept:    "kept",
+		Raw:     map[string]string{"a": "b"},
+	}
+
+	if !reflect.DeepEqual(u, expected) {
+		t.Errorf("Decode should set %+v, got: %+v", expected, u)
+	}
+}
+
+func TestDecode_RoundTrip(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		ID    int `structs:"id"`
+		B     `structs:",flatten"`
+		Items []B
+	}
+
+	a := A{ID: 1, B: B{Name: "example"}, Items: []B{{Name: "item"}}}
+
+	var decoded A
+	if err := New(&decoded).Decode(Map(a)); err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, a) {
+		t.Errorf("Decode should round trip %+v, got: %+v", a, decoded)
+	}
+}
+
+func TestDecode_RoundTripFlatten(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type Point struct {
+		X, Y int
+	}
+
+	type A struct {
+		ID      int
+		Created time.Time
+		Origin  Point
+		Inner   B
+	}
+
+	a := A{ID: 1, Created: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), Origin: Point{1, 2}, Inner: B{Name: "example"}}
+
+	s := New(a)
+	s.Flatten = true
+	s.LeafTypes = []reflect.Type{reflect.TypeOf(Point{})}
+
+	var decoded A
+	d := New(&decoded)
+	d.Flatten = true
+	d.LeafTypes = s.LeafTypes
+
+	// time.Time and leaf types are emitted under their own key
+	if err := d.Decode(s.Map()); err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, a) {
+		t.Errorf("Decode should round trip %+v, got: %+v", a, decoded)
+	}
+}
+
+func TestDecode_RoundTripFlattenPointer(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		ID int
+		B  *B `structs:",flatten"`
+	}
+
+	for _, a := range []A{{ID: 1, B: &B{Name: "example"}}, {ID: 1}} {
+		var decoded A
+		if err := New(&decoded).Decode(Map(a)); err != nil {
+			t.Fatalf("Decode should not return an error, got: %s", err)
+		}
+
+		if !reflect.DeepEqual(decoded, a) {
+			t.Errorf("Decode should round trip %+v, got: %+v", a, decoded)
+		}
+	}
+}
+
+func TestDecode_Time(t *testing.T) {
+	type A struct {
+		CreatedAt time.Time   `structs:"created_at"`
+		UpdatedAt *time.Time  `structs:"updated_at"`
+		History   []time.Time `structs:"history"`
+	}
+
+	var a A
+	s := New(&a)
+	s.TimeFormat = "2006-01-02 15:04"
+
+	m := map[string]interface{}{
+		"created_at": "2020-01-02 12:30",
+		"updated_at": int64(1577968200),
+		"history":    []interface{}{1577968200.5},
+	}
+
+	if err := s.Decode(m); err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	expected := time.Date(2020, 1, 2, 12, 30, 0, 0, time.UTC)
+
+	if !a.CreatedAt.Equal(expected) || a.CreatedAt.Location() != time.UTC {
+		t.Errorf("Decode should parse strings with TimeFormat, expected %s, got: %s", expected, a.CreatedAt)
+	}
+
+	if a.UpdatedAt == nil || !a.UpdatedAt.Equal(expected) {
+		t.Errorf("Decode should decode numbers as unix timestamps, expected %s, got: %v", expected, a.UpdatedAt)
+	}
+
+	if len(a.History) != 1 || !a.History[0].Equal(expected.Add(500*time.Millisecond)) {
+		t.Errorf("Decode should decode fractional unix timestamps, got: %v", a.History)
+	}
+
+	out := s.Map()
+	if out["created_at"] != "2020-01-02 12:30" || !reflect.DeepEqual(out["history"], []interface{}{"2020-01-02 12:30"}) {
+		t.Errorf("Map should format times with TimeFormat, got: %v", out)
+	}
+
+	var decoded A
+	if err := New(&decoded, func(s *Struct) { s.TimeFormat = "2006-01-02 15:04" }).Decode(out); err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	if !decoded.CreatedAt.Equal(expected) || !decoded.UpdatedAt.Equal(expected) {
+		t.Errorf("Decode should round trip formatted times, got: %+v", decoded)
+	}
+
+	err := New(&a).Decode(map[string]interface{}{"created_at": "2020-01-02 12:30"})
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "created_at" {
+		t.Errorf("Decode should return a FieldError for a string not matching the layout, got: %v", err)
+	}
+}
+
+func TestDecode_ReadOnly(t *testing.T) {
+	type Meta struct {
+		CreatedBy string `structs:"created_by,readonly"`
+		Note      string `structs:"note"`
+	}
+
+	type A struct {
+		ID   int    `structs:"id,readonly"`
+		Name string `structs:"name"`
+		Meta Meta   `structs:"meta"`
+	}
+
+	a := A{ID: 1, Name: "example", Meta: Meta{CreatedBy: "admin"}}
+
+	m := Map(a)
+	if m["id"] != 1 || m["meta"].(map[string]interface{})["created_by"] != "admin" {
+		t.Errorf("Map should emit readonly fields, got: %v", m)
+	}
+
+	in := map[string]interface{}{
+		"id":   2,
+		"name": "changed",
+		"meta": map[string]interface{}{"created_by": "user", "note": "note"},
+	}
+
+	if err := New(&a).Decode(in); err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	expected := A{ID: 1, Name: "changed", Meta: Meta{CreatedBy: "admin", Note: "note"}}
+	if !reflect.DeepEqual(a, expected) {
+		t.Errorf("Decode should not set readonly fields, expected %+v, got: %+v", expected, a)
+	}
+
+	s := New(&a)
+	s.Strict = true
+
+	changed, err := s.ApplyPatch(map[string]interface{}{"id": 3, "name": "patched"})
+	if err != nil {
+		t.Fatalf("ApplyPatch should not return an error, got: %s", err)
+	}
+
+	if a.ID != 1 || !reflect.DeepEqual(changed, []string{"name"}) {
+		t.Errorf("ApplyPatch should ignore readonly fields, got: %+v, changed: %v", a, changed)
+	}
+}
+
+func TestDecode_Alias(t *testing.T) {
+	type A struct {
+		Name  string `structs:"name,alias=username;login"`
+		Email string `structs:"email,alias=mail"`
+		Port  int    `structs:"port,alias=legacy_port"`
+	}
+
+	var a A
+	err := New(&a).Decode(map[string]interface{}{
+		"login":       "example",
+		"email":       "new@example.com",
+		"mail":        "old@example.com",
+		"legacy_port": 80,
+	})
+	if err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	expected := A{Name: "example", Email: "new@example.com", Port: 80}
+	if a != expected {
+		t.Errorf("Decode should match the aliases, expected %+v, got: %+v", expected, a)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	type A struct {
+		Name string
+	}
+
+	if err := New(A{}).Decode(map[string]interface{}{"Name": "a"}); !errors.Is(err, ErrNotSettable) {
+		t.Errorf("Decode should return ErrNotSettable for a non pointer, got: %v", err)
+	}
+
+	if err := New(&A{}).Decode(map[string]interface{}{"Name": 1}); err == nil {
+		t.Error("Decode should return an error for a mismatched type")
+	}
+}
+
+func TestDecode_FieldError(t *testing.T) {
+	type C struct {
+		Port int `structs:"port"`
+	}
+
+	type B struct {
+		Servers []C `structs:"servers"`
+	}
+
+	type A struct {
+		Config B `structs:"config"`
+	}
+
+	err := New(&A{}).Decode(map[string]interface{}{
+		"config": map[string]interface{}{
+			"servers": []interface{}{
+				map[string]interface{}{"port": 80},
+				map[string]interface{}{"port": "http"},
+			},
+		},
+	})
+
+	var fe *FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("Decode should return a *FieldError, got: %v", err)
+	}
+
+	if fe.Path != "config.servers.1.port" || fe.GoName != "Port" || fe.Key != "port" {
+		t.Errorf("Decode should report the path of the field, got: %+v", fe)
+	}
+
+	expected := "config.servers.1.port (Port): cannot decode string into int"
+	if err.Error() != expected {
+		t.Errorf("FieldError should return %q, got: %q", expected, err)
+	}
+}
+
+func TestDecode_FieldErrorElements(t *testing.T) {
+	type A struct {
+		Tags   []int            `structs:"tags"`
+		Scores map[string][]int `structs:"scores"`
+	}
+
+	tests := []struct {
+		m        map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"tags": []interface{}{1, "two"}}, "tags.1"},
+		{map[string]interface{}{"scores": map[string]interface{}{"a": []interface{}{"x"}}}, "scores.a.0"},
+	}
+
+	for _, test := range tests {
+		err := New(&A{}).Decode(test.m)
+
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			t.Fatalf("Decode should return a *FieldError, got: %v", err)
+		}
+
+		if fe.Path != test.expected || fe.GoName == "" || fe.Err.Error() != "cannot decode string into int" {
+			t.Errorf("Decode should report the path %q of the element, got: %+v", test.expected, fe)
+		}
+	}
+
+	err := New(&A{}).Decode(tests[0].m)
+	if expected := "tags.1 (Tags): cannot decode string into int"; err.Error() != expected {
+		t.Errorf("FieldError should return %q, got: %q", expected, err)
+	}
+}
+
+func TestDecode_NumberCoercion(t *testing.T) {
+	type A struct {
+		Int   int
+		Int8  int8
+		Uint  uint
+		Float float32
+	}
+
+	tests := []struct {
+		policy   NumberCoercion
+		in       map[string]interface{}
+		expected A
+		err      bool
+	}{
+		{NumberStrict, map[string]interface{}{"Int": 3.0}, A{Int: 3}, false},
+		{NumberStrict, map[string]interface{}{"Int": 3.5}, A{}, true},
+		{NumberStrict, map[string]interface{}{"Int8": 300}, A{}, true},
+		{NumberStrict, map[string]interface{}{"Uint": -1}, A{}, true},
+		{NumberStrict, map[string]interface{}{"Uint": int64(7)}, A{Uint: 7}, false},
+		{NumberStrict, map[string]interface{}{"Float": 2}, A{Float: 2}, false},
+		{NumberLossy, map[string]interface{}{"Int": 3.0}, A{Int: 3}, false},
+		{NumberLossy, map[string]interface{}{"Int": 3.5}, A{Int: 3}, false},
+		{NumberLossy, map[string]interface{}{"Int8": 300}, A{Int8: 44}, false},
+		{NumberLossy, map[string]interface{}{"Float": 1.5}, A{Float: 1.5}, false},
+	}
+
+	for _, test := range tests {
+		var a A
+		s := New(&a)
+		s.NumberCoercion = test.policy
+
+		err := s.Decode(test.in)
+		if (err != nil) != test.err {
+			t.Errorf("Decode(%v) with policy %d should return error %t, got: %v", test.in, test.policy, test.err, err)
+			continue
+		}
+
+		if !test.err && a != test.expected {
+			t.Errorf("Decode(%v) with policy %d should set %+v, got: %+v", test.in, test.policy, test.expected, a)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	type Address struct {
+		City string `structs:"city"`
+		Zip  string `structs:"zip"`
+	}
+
+	type User struct {
+		Name    string   `structs:"name"`
+		Age     int      `structs:"age"`
+		Email   string   `structs:"email"`
+		Address *Address `structs:"address"`
+	}
+
+	u := &User{Name: "example", Age: 30, Email: "a@example.com", Address: &Address{City: "Paris", Zip: "75000"}}
+	s := New(u)
+
+	changed, err := s.ApplyPatch(map[string]interface{}{
+		"age":     31.0,
+		"email":   "a@example.com",
+		"address": map[string]interface{}{"city": "Rome"},
+		"unknown": true,
+	})
+	if err != nil {
+		t.Fatalf("ApplyPatch should not return an error, got: %s", err)
+	}
+
+	if expected := []string{"age", "address"}; !reflect.DeepEqual(changed, expected) {
+		t.Errorf("ApplyPatch should return the changed keys %v, got: %v", expected, changed)
+	}
+
+	expected := User{Name: "example", Age: 31, Email: "a@example.com", Address: &Address{City: "Rome", Zip: "75000"}}
+	if !reflect.DeepEqual(*u, expected) {
+		t.Errorf("ApplyPatch should set the patched fields, expected %+v, got: %+v", expected, *u)
+	}
+
+	if _, err := s.ApplyPatch(map[string]interface{}{"age": "old"}); err == nil {
+		t.Error("ApplyPatch should return an error for a mismatched type")
+	}
+
+	s.Strict = true
+	if _, err := s.ApplyPatch(map[string]interface{}{"name": "new", "unknown": true}); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("ApplyPatch should return ErrFieldNotFound in Strict mode, got: %v", err)
+	}
+
+	if u.Name != "example" {
+		t.Errorf("ApplyPatch should not set fields in Strict mode with unknown keys, got: %s", u.Name)
+	}
+
+	if _, err := New(*u).ApplyPatch(map[string]interface{}{"name": "new"}); !errors.Is(err, ErrNotSettable) {
+		t.Errorf("ApplyPatch should return ErrNotSettable for a non pointer, got: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// DiffTree compares the structs a and b, which must be of the same type, and
+// returns the differing fields as a tree mirroring the shape of Map. Every
+// changed leaf is represented as map[string]interface{}{"old": x, "new": y},
+// nested structs only contain their changed fields and unchanged fields are
+// left out. Fields excluded from Map are ignored.
+func DiffTree(a, b interface{}) (map[string]interface{}, error) {
+	if err := checkSameStruct(a, b); err != nil {
+		return nil, err
+	}
+
+	return diffTree(Map(a), Map(b)), nil
+}
+
+func diffTree(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+
+	diff := func(k string) {
+		va, okA := a[k]
+		vb, okB := b[k]
+
+		ma, isMapA := va.(map[string]interface{})
+		mb, isMapB := vb.(map[string]interface{})
+		if isMapA && isMapB {
+			if sub := diffTree(ma, mb); len(sub) > 0 {
+				out[k] = sub
+			}
+			return
+		}
+
+		if okA != okB || !reflect.DeepEqual(va, vb) {
+			out[k] = map[string]interface{}{"old": va, "new": vb}
+		}
+	}
+
+	for k := range a {
+		diff(k)
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			diff(k)
+		}
+	}
+
+	return out
+}
+
+// FieldDiff is a field whose value differs between two structs, as
+// returned by DiffFields. A and B are the values of the field in each
+// struct, or nil if the field is not emitted in that struct.
+type FieldDiff struct {
+	Path string
+	A    interface{}
+	B    interface{}
+}
+
+// DiffFields compares the structs a and b, which must be of the same type,
+// and returns the differing fields with their dotted paths, ie:
+// "Address.City". Nested structs are compared field by field. Top level
+// fields are returned in declaration order, followed by the fields only
+// emitted by b, and the fields of nested structs are sorted by key. Fields
+// excluded from Map are ignored.
+func DiffFields(a, b interface{}) ([]FieldDiff, error) {
+	if err := checkSameStruct(a, b); err != nil {
+		return nil, err
+	}
+
+	pa, pb := New(a).OrderedMap(), New(b).OrderedMap()
+
+	keys := make([]string, 0, len(pa))
+	ma := make(map[string]interface{}, len(pa))
+	for _, kv := range pa {
+		keys = append(keys, kv.Key)
+		ma[kv.Key] = kv.Value
+	}
+
+	mb := make(map[string]interface{}, len(pb))
+	for _, kv := range pb {
+		if _, ok := ma[kv.Key]; !ok {
+			keys = append(keys, kv.Key)
+		}
+		mb[kv.Key] = kv.Value
+	}
+
+	return diffFields(nil, "", keys, ma, mb), nil
+}
+
+func diffFields(out []FieldDiff, prefix string, keys []string, a, b map[string]interface{}) []FieldDiff {
+	for _, k := range keys {
+		path := joinPath(prefix, k)
+		va, okA := a[k]
+		vb, okB := b[k]
+
+		ma, isMapA := va.(map[string]interface{})
+		mb, isMapB := vb.(map[string]interface{})
+		if isMapA && isMapB {
+			out = diffFields(out, path, sortedKeys(ma, mb), ma, mb)
+			continue
+		}
+
+		if okA != okB || !reflect.DeepEqual(va, vb) {
+			out = append(out, FieldDiff{Path: path, A: va, B: vb})
+		}
+	}
+
+	return out
+}
+
+// sortedKeys returns the sorted keys of both a and b.
+func sortedKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// checkSameStruct returns an error if a and b are not structs, or pointers
+// to structs, of the same type.
+func checkSameStruct(a, b interface{}) error {
+	ta, tb := structType(a), structType(b)
+
+	if ta == nil || ta.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrNotStruct, a)
+	}
+
+	if tb == nil || tb.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrNotStruct, b)
+	}
+
+	if ta != tb {
+		return fmt.Errorf("mismatched types %s and %s", ta, tb)
+	}
+
+	return nil
+}
+
+// structType returns the type of v, dereferencing pointer types.
+func structType(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// ChangedSince returns the keys and current values of all fields whose value
+// differs from the given snapshot, as taken earlier with Map. Nested structs
+// are compared field by field and their changes are returned under dotted
+// keys, ie: "Address.City". Keys missing from the snapshot are considered
+// changed, and keys of the snapshot which are no longer emitted, ie: fields
+// now omitted with omitempty, are returned with a nil value. Note that
+// slices and maps in a snapshot share their memory with the struct, so
+// modifying them in place isn't detected.
+func (s *Struct) ChangedSince(snapshot map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	changedSince(out, "", s.Map(), snapshot)
+	return out
+}
+
+func changedSince(out map[string]interface{}, prefix string, current, snapshot map[string]interface{}) {
+	for k, val := range current {
+		key := joinPath(prefix, k)
+		old, ok := snapshot[k]
+
+		m, isMap := val.(map[string]interface{})
+		oldMap, isOldMap := old.(map[string]interface{})
+		if isMap && isOldMap {
+			changedSince(out, key, m, oldMap)
+			continue
+		}
+
+		if !ok || !reflect.DeepEqual(val, old) {
+			out[key] = val
+		}
+	}
+
+	for k := range snapshot {
+		if _, ok := current[k]; !ok {
+			out[joinPath(prefix, k)] = nil
+		}
+	}
+}
+
+// joinPath joins the key to the dotted path prefix.
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,178 @@
+package structs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChangedSince(t *testing.T) {
+	type address struct {
+		City    string
+		Country string
+	}
+
+	type user struct {
+		Name    string
+		Age     int
+		Address address
+	}
+
+	u := &user{Name: "example", Age: 30, Address: address{City: "Istanbul", Country: "Turkey"}}
+	s := New(u)
+
+	snapshot := s.Map()
+
+	if changed := s.ChangedSince(snapshot); len(changed) != 0 {
+		t.Errorf("ChangedSince should return no changes for an unmodified struct, got: %v", changed)
+	}
+
+	u.Address.City = "Ankara"
+
+	expected := map[string]interface{}{"Address.City": "Ankara"}
+	if changed := s.ChangedSince(snapshot); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("ChangedSince should return %v, got: %v", expected, changed)
+	}
+}
+
+func TestChangedSince_MissingKeys(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	s := New(user{Name: "example", Age: 30})
+
+	expected := map[string]interface{}{"Age": 30}
+	if changed := s.ChangedSince(map[string]interface{}{"Name": "example"}); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("ChangedSince should return %v, got: %v", expected, changed)
+	}
+}
+
+func TestChangedSince_RemovedKeys(t *testing.T) {
+	type address struct {
+		City string `structs:",omitempty"`
+		Zip  int
+	}
+
+	type user struct {
+		Name    string `structs:",omitempty"`
+		Age     int
+		Address address
+	}
+
+	u := &user{Name: "example", Age: 30, Address: address{City: "Istanbul", Zip: 34000}}
+	s := New(u)
+
+	snapshot := s.Map()
+
+	u.Name = ""
+	u.Address.City = ""
+
+	expected := map[string]interface{}{"Name": nil, "Address.City": nil}
+	if changed := s.ChangedSince(snapshot); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("ChangedSince should return %v, got: %v", expected, changed)
+	}
+}
+
+func TestDiffTree(t *testing.T) {
+	type address struct {
+		City    string
+		Country string
+	}
+
+	type user struct {
+		Name     string
+		Age      int
+		Password string `structs:"-"`
+		Address  address
+	}
+
+	a := user{Name: "example", Age: 30, Password: "a", Address: address{City: "Istanbul", Country: "Turkey"}}
+	b := user{Name: "example", Age: 31, Password: "b", Address: address{City: "Ankara", Country: "Turkey"}}
+
+	diff, err := DiffTree(a, &b)
+	if err != nil {
+		t.Fatalf("DiffTree should not return an error, got: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"Age": map[string]interface{}{"old": 30, "new": 31},
+		"Address": map[string]interface{}{
+			"City": map[string]interface{}{"old": "Istanbul", "new": "Ankara"},
+		},
+	}
+
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffTree should return %v, got: %v", expected, diff)
+	}
+
+	diff, err = DiffTree(a, a)
+	if err != nil {
+		t.Fatalf("DiffTree should not return an error, got: %s", err)
+	}
+
+	if len(diff) != 0 {
+		t.Errorf("DiffTree should return an empty tree for equal structs, got: %v", diff)
+	}
+}
+
+func TestDiffTree_Errors(t *testing.T) {
+	type A struct{ Name string }
+	type B struct{ Name string }
+
+	if _, err := DiffTree(A{}, 1); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("DiffTree should return ErrNotStruct for a non struct, got: %v", err)
+	}
+
+	if _, err := DiffTree(A{}, B{}); err == nil {
+		t.Error("DiffTree should return an error for structs of different types")
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	type address struct {
+		Street  string
+		Country string
+		City    string
+	}
+
+	type user struct {
+		Name     string
+		Age      int
+		Password string `structs:"-"`
+		Address  address
+		Nickname string `structs:",omitempty"`
+		Email    string
+	}
+
+	a := user{Name: "example", Age: 30, Password: "a", Email: "a@example.com",
+		Address: address{Street: "main", City: "Istanbul", Country: "Turkey"}}
+	b := user{Name: "example", Age: 31, Password: "b", Nickname: "ex", Email: "b@example.com",
+		Address: address{Street: "side", City: "Ankara", Country: "Turkey"}}
+
+	diff, err := DiffFields(&a, b)
+	if err != nil {
+		t.Fatalf("DiffFields should not return an error, got: %s", err)
+	}
+
+	expected := []FieldDiff{
+		{Path: "Age", A: 30, B: 31},
+		{Path: "Address.City", A: "Istanbul", B: "Ankara"},
+		{Path: "Address.Street", A: "main", B: "side"},
+		{Path: "Email", A: "a@example.com", B: "b@example.com"},
+		{Path: "Nickname", A: nil, B: "ex"},
+	}
+
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("DiffFields should return %v, got: %v", expected, diff)
+	}
+
+	if diff, err := DiffFields(a, a); err != nil || len(diff) != 0 {
+		t.Errorf("DiffFields should return no differences for equal structs, got: %v, %v", diff, err)
+	}
+
+	if _, err := DiffFields(a, 1); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("DiffFields should return ErrNotStruct for a non struct, got: %v", err)
+	}
+}
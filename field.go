@@ -0,0 +1,361 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Field represents a single struct field that encapsulates high level
+// functions around the field.
+type Field struct {
+	value reflect.Value
+	field reflect.StructField
+	s     *Struct // the struct the field belongs to
+}
+
+// Name returns the Go name of the given field.
+func (f *Field) Name() string {
+	return f.field.Name
+}
+
+// MappedName returns the key under which the field is emitted by Map with
+// the current settings of its struct, ie: the tag name of the field, or its
+// Go name if it has none.
+func (f *Field) MappedName() string {
+	return f.s.fieldKey(f.field)
+}
+
+// Value returns the underlying value of the field.
+func (f *Field) Value() interface{} {
+	return f.value.Interface()
+}
+
+// Kind returns the field's kind, such as "string", "map", "bool", etc ..
+func (f *Field) Kind() reflect.Kind {
+	return f.value.Kind()
+}
+
+// Tag returns the value associated with key in the tag string of the field,
+// ie: f.Tag("json"). It returns an empty string if there is no such key.
+func (f *Field) Tag(key string) string {
+	return f.field.Tag.Get(key)
+}
+
+// RawTag returns the complete, unparsed tag string of the field.
+func (f *Field) RawTag() reflect.StructTag {
+	return f.field.Tag
+}
+
+// FieldOk returns the nested field with the given Go field name of the
+// field's struct value. It returns false if the field is not a struct or a
+// non-nil pointer to a struct, or if the nested field does not exist, which
+// allows to safely navigate into nested structs:
+//
+//	f, ok := s.FieldOk("Address")
+//	if ok {
+//		f, ok = f.FieldOk("City")
+//	}
+func (f *Field) FieldOk(name string) (*Field, bool) {
+	n, ok := f.nested()
+	if !ok {
+		return nil, false
+	}
+
+	return n.FieldOk(name)
+}
+
+// FieldOk returns the field with the given Go field name. It returns false
+// if the field does not exist or is not exported.
+func (s *Struct) FieldOk(name string) (*Field, bool) {
+	for _, f := range s.fields() {
+		if f.Name() == name {
+			return f, true
+		}
+	}
+
+	return nil, false
+}
+
+// FieldsWithOption returns the fields whose tag includes the given option,
+// ie: "omitempty", in declaration order. If nested is true the fields of
+// nested structs are searched as well.
+func (s *Struct) FieldsWithOption(opt string, nested bool) []*Field {
+	var fields []*Field
+
+	for _, f := range s.fields() {
+		_, tagOpts := s.parseTag(f.field)
+		if tagOpts.Has(opt) {
+			fields = append(fields, f)
+		}
+
+		if n, ok := f.nested(); ok && nested {
+			fields = append(fields, n.FieldsWithOption(opt, nested)...)
+		}
+	}
+
+	return fields
+}
+
+// GroupByOption returns the fields grouped by the value of their key=value
+// tag option optKey, ie: "section" for `structs:"name,section=basic"`.
+// Fields without the option are grouped under the empty string. Fields keep
+// their declaration order within a group.
+func (s *Struct) GroupByOption(optKey string) map[string][]*Field {
+	groups := make(map[string][]*Field)
+
+	for _, f := range s.fields() {
+		_, tagOpts := s.parseTag(f.field)
+		group, _ := tagOpts.Get(optKey)
+		groups[group] = append(groups[group], f)
+	}
+
+	return groups
+}
+
+// SettableFields returns the exported fields of the struct which can be
+// set, ie: for binding HTTP forms. Fields can only be set if the *Struct was
+// created with a pointer.
+func (s *Struct) SettableFields() []*Field {
+	var fields []*Field
+
+	for _, f := range s.fields() {
+		if f.value.CanSet() {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// NonZeroFields returns the exported fields of the struct whose value is not
+// the zero value of their type, in declaration order, ie: for generating SQL
+// which only sets the populated columns. Nested structs are returned as a
+// single field if any of their fields is set. Use NonZeroLeafFields to
+// recurse into them.
+func (s *Struct) NonZeroFields() []*Field {
+	var fields []*Field
+
+	for _, f := range s.fields() {
+		if !f.value.IsZero() {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// NonZeroLeafFields is the same as NonZeroFields, but recurses into nested
+// structs and non-nil pointers to structs, returning their non-zero leaf
+// fields instead of the nested structs themselves, in declaration order.
+// Structs without exported fields, ie: time.Time, are leaves too.
+func (s *Struct) NonZeroLeafFields() []*Field {
+	var fields []*Field
+
+	for _, f := range s.fields() {
+		if n, ok := f.nested(); ok && len(n.structFields()) > 0 {
+			fields = append(fields, n.NonZeroLeafFields()...)
+			continue
+		}
+
+		if !f.value.IsZero() {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// Transform calls fn for every leaf field of the struct, recursing into
+// nested structs and non-nil pointers to structs, in declaration order. If
+// fn returns true, the field is set to the returned value, which must be
+// assignable to the field's type. Structs without exported fields, ie:
+// time.Time, are leaves too. The *Struct must be created with a pointer,
+// otherwise ErrNotSettable is returned.
+func (s *Struct) Transform(fn func(f *Field) (interface{}, bool)) error {
+	if !s.value.CanSet() {
+		return ErrNotSettable
+	}
+
+	return s.transform("", fn)
+}
+
+func (s *Struct) transform(prefix string, fn func(f *Field) (interface{}, bool)) error {
+	for _, f := range s.fields() {
+		path := joinPath(prefix, f.Name())
+
+		if n, ok := f.nested(); ok && len(n.structFields()) > 0 {
+			if err := n.transform(path, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		val, ok := fn(f)
+		if !ok {
+			continue
+		}
+
+		if err := f.set(val); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// SetPath sets the field at the given dotted path of Go field names, ie:
+// "Address.Geo.Lat", to value, which must be assignable to the field's
+// type. Nil pointers to structs along the path are allocated. The *Struct
+// must be created with a pointer, otherwise ErrNotSettable is returned.
+func (s *Struct) SetPath(path string, value interface{}) error {
+	if !s.value.CanSet() {
+		return ErrNotSettable
+	}
+
+	names := strings.Split(path, ".")
+	n := s
+
+	for i, name := range names {
+		current := strings.Join(names[:i+1], ".")
+
+		f, ok := n.FieldOk(name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrFieldNotFound, current)
+		}
+
+		if i == len(names)-1 {
+			if err := f.set(value); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			return nil
+		}
+
+		if v := f.value; v.Kind() == reflect.Ptr && v.IsNil() && v.Type().Elem().Kind() == reflect.Struct {
+			if !v.CanSet() {
+				return fmt.Errorf("%s: %w", current, ErrNotSettable)
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		if n, ok = f.nested(); !ok {
+			return fmt.Errorf("%w: %s", ErrNotStruct, current)
+		}
+	}
+
+	return nil
+}
+
+// KeyPath returns the dotted path of keys under which the field at the given
+// dotted path of Go field names, ie: "Address.Zip", is emitted by Map, ie:
+// "address.zip_code". Flattened structs have no key of their own and are
+// left out of the returned path. It returns false if a field along the path
+// doesn't exist, isn't a struct but for the last one, or is a flattened
+// struct itself. Only the types of the fields are inspected, so nil pointers
+// along the path are allowed.
+func (s *Struct) KeyPath(goPath string) (string, bool) {
+	var keys []string
+
+	names := strings.Split(goPath, ".")
+	n := s
+	t := s.value.Type()
+
+	for i, name := range names {
+		field, ok := lookupField(n.typeFields(t, t, nil), name)
+		if !ok {
+			return "", false
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		_, tagOpts := n.parseTag(field)
+		flattened := ft.Kind() == reflect.Struct && (tagOpts.Has("flatten") || n.flatten())
+
+		last := i == len(names)-1
+		if last && flattened || !last && ft.Kind() != reflect.Struct {
+			return "", false
+		}
+
+		if !flattened {
+			keys = append(keys, n.fieldKey(field))
+		}
+
+		// the configuration of nested structs, as with sub
+		next := *n
+		next.renames = nil
+		next.depth++
+		n, t = &next, ft
+	}
+
+	return strings.Join(keys, "."), true
+}
+
+// lookupField returns the field with the given Go field name.
+func lookupField(fields []reflect.StructField, name string) (reflect.StructField, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// set sets the field to the given value, which must be assignable to the
+// field's type. A nil value sets the field to its zero value.
+func (f *Field) set(val interface{}) error {
+	if !f.value.CanSet() {
+		return ErrNotSettable
+	}
+
+	if val == nil {
+		f.value.Set(reflect.Zero(f.value.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(val)
+	if !v.Type().AssignableTo(f.value.Type()) {
+		return fmt.Errorf("cannot assign %s to %s", v.Type(), f.value.Type())
+	}
+
+	f.value.Set(v)
+	return nil
+}
+
+// fields returns the exported fields of s as *Field.
+func (s *Struct) fields() []*Field {
+	var fields []*Field
+
+	for _, field := range s.structFields() {
+		fields = append(fields, &Field{
+			value: s.value.FieldByIndex(field.Index),
+			field: field,
+			s:     s,
+		})
+	}
+
+	return fields
+}
+
+// nested returns a *Struct for the field's value if it's a struct or a
+// non-nil pointer to a struct.
+func (f *Field) nested() (*Struct, bool) {
+	v := f.value
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	// keep nested structs of addressable values settable
+	if f.value.Kind() == reflect.Struct && f.value.CanAddr() {
+		return f.s.sub(f.value.Addr().Interface()), true
+	}
+
+	return f.s.sub(f.value.Interface()), true
+}
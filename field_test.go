@@ -0,0 +1,490 @@
+package structs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFieldsWithOption(t *testing.T) {
+	type C struct {
+		Zip  string `structs:"zip,omitempty"`
+		City string `structs:"city"`
+	}
+
+	type B struct {
+		Street string `structs:"street,omitempty"`
+		C      *C     `structs:"c,omitempty"`
+	}
+
+	type A struct {
+		Name  string `structs:"name,omitempty"`
+		Value int    `structs:"value"`
+		B     B      `structs:"b"`
+		Other string `structs:",omitnested,omitempty"`
+	}
+
+	a := A{B: B{C: &C{}}}
+
+	names := func(fields []*Field) []string {
+		var n []string
+		for _, f := range fields {
+			n = append(n, f.Name())
+		}
+		return n
+	}
+
+	expected := []string{"Name", "Other"}
+	if got := names(New(a).FieldsWithOption("omitempty", false)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FieldsWithOption should return %v, got: %v", expected, got)
+	}
+
+	expected = []string{"Name", "Street", "C", "Zip", "Other"}
+	if got := names(New(a).FieldsWithOption("omitempty", true)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FieldsWithOption with nested should return %v, got: %v", expected, got)
+	}
+
+	if got := New(a).FieldsWithOption("missing", true); len(got) != 0 {
+		t.Errorf("FieldsWithOption should return no fields for an unknown option, got: %v", names(got))
+	}
+}
+
+func TestField(t *testing.T) {
+	type A struct {
+		Name string
+	}
+
+	fields := New(A{Name: "example"}).fields()
+	if len(fields) != 1 {
+		t.Fatalf("fields should return 1 field, got: %d", len(fields))
+	}
+
+	f := fields[0]
+
+	if f.Name() != "Name" {
+		t.Errorf("Field's name should be Name, got: %s", f.Name())
+	}
+
+	if f.Value() != "example" {
+		t.Errorf("Field's value should be example, got: %v", f.Value())
+	}
+
+	if f.Kind() != reflect.String {
+		t.Errorf("Field's kind should be string, got: %s", f.Kind())
+	}
+}
+
+func TestFieldOk(t *testing.T) {
+	type C struct {
+		Zip string
+	}
+
+	type B struct {
+		Street string
+		C      *C
+		Nil    *C
+	}
+
+	type A struct {
+		Name string
+		B    B
+	}
+
+	a := A{Name: "example", B: B{Street: "main", C: &C{Zip: "34000"}}}
+	s := New(a)
+
+	b, ok := s.FieldOk("B")
+	if !ok {
+		t.Fatal("FieldOk should return the B field")
+	}
+
+	c, ok := b.FieldOk("C")
+	if !ok {
+		t.Fatal("FieldOk should return the nested C field")
+	}
+
+	zip, ok := c.FieldOk("Zip")
+	if !ok {
+		t.Fatal("FieldOk should return the nested Zip field through a pointer")
+	}
+
+	if zip.Value() != "34000" {
+		t.Errorf("Zip field's value should be 34000, got: %v", zip.Value())
+	}
+
+	name, ok := s.FieldOk("Name")
+	if !ok {
+		t.Fatal("FieldOk should return the Name field")
+	}
+
+	if _, ok := name.FieldOk("Anything"); ok {
+		t.Error("FieldOk should return false for a field which is not a struct")
+	}
+
+	if _, ok := b.FieldOk("Missing"); ok {
+		t.Error("FieldOk should return false for a missing nested field")
+	}
+
+	nilField, _ := b.FieldOk("Nil")
+	if _, ok := nilField.FieldOk("Zip"); ok {
+		t.Error("FieldOk should return false for a nil struct pointer")
+	}
+
+	if _, ok := s.FieldOk("Missing"); ok {
+		t.Error("FieldOk should return false for a missing field")
+	}
+}
+
+func TestField_Tag(t *testing.T) {
+	type A struct {
+		Name  string `structs:"name,omitempty" json:"full_name" validate:"required"`
+		Value int
+	}
+
+	s := New(A{})
+
+	name, _ := s.FieldOk("Name")
+
+	if tag := name.Tag("json"); tag != "full_name" {
+		t.Errorf("Tag should return the json tag full_name, got: %s", tag)
+	}
+
+	if tag := name.Tag("validate"); tag != "required" {
+		t.Errorf("Tag should return the validate tag required, got: %s", tag)
+	}
+
+	if tag := name.Tag("structs"); tag != "name,omitempty" {
+		t.Errorf("Tag should return the unparsed structs tag, got: %s", tag)
+	}
+
+	expected := reflect.StructTag(`structs:"name,omitempty" json:"full_name" validate:"required"`)
+	if raw := name.RawTag(); raw != expected {
+		t.Errorf("RawTag should return %s, got: %s", expected, raw)
+	}
+
+	value, _ := s.FieldOk("Value")
+
+	if tag := value.Tag("json"); tag != "" {
+		t.Errorf("Tag should return an empty string for a missing tag, got: %s", tag)
+	}
+
+	if raw := value.RawTag(); raw != "" {
+		t.Errorf("RawTag should return an empty tag, got: %s", raw)
+	}
+}
+
+func TestGroupByOption(t *testing.T) {
+	type A struct {
+		Name    string `structs:"name,section=basic"`
+		Email   string `structs:"email,omitempty,section=basic"`
+		Proxy   string `structs:"proxy,section=advanced"`
+		Timeout int    `structs:"timeout,section=advanced"`
+		ID      int    `structs:"id"`
+	}
+
+	groups := New(A{}).GroupByOption("section")
+
+	names := make(map[string][]string)
+	for group, fields := range groups {
+		for _, f := range fields {
+			names[group] = append(names[group], f.Name())
+		}
+	}
+
+	expected := map[string][]string{
+		"basic":    {"Name", "Email"},
+		"advanced": {"Proxy", "Timeout"},
+		"":         {"ID"},
+	}
+
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("GroupByOption should return %v, got: %v", expected, names)
+	}
+}
+
+func TestField_MappedName(t *testing.T) {
+	type A struct {
+		Name  string `structs:"name,omitempty"`
+		Value int    `structs:",omitempty"`
+		Other string `json:"other"`
+	}
+
+	s := New(A{})
+
+	names := map[string]string{
+		"Name":  "name",
+		"Value": "Value",
+		"Other": "Other",
+	}
+
+	for goName, expected := range names {
+		f, _ := s.FieldOk(goName)
+		if name := f.MappedName(); name != expected {
+			t.Errorf("MappedName of %s should return %s, got: %s", goName, expected, name)
+		}
+	}
+
+	s.TagName = "json"
+
+	f, _ := s.FieldOk("Other")
+	if name := f.MappedName(); name != "other" {
+		t.Errorf("MappedName should use the struct's tag name, got: %s", name)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	type C struct {
+		Zip string
+	}
+
+	type B struct {
+		Street string
+		C      *C
+		Lines  []string
+	}
+
+	type A struct {
+		Name    string
+		Count   int
+		B       B
+		Created time.Time
+	}
+
+	a := &A{
+		Name:  "  example ",
+		Count: 2,
+		B:     B{Street: " main\t", C: &C{Zip: " 34000 "}, Lines: []string{" a "}},
+	}
+
+	var visited []string
+
+	err := New(a).Transform(func(f *Field) (interface{}, bool) {
+		visited = append(visited, f.Name())
+		if s, ok := f.Value().(string); ok {
+			return strings.TrimSpace(s), true
+		}
+		return nil, false
+	})
+	if err != nil {
+		t.Fatalf("Transform should not return an error, got: %s", err)
+	}
+
+	if a.Name != "example" || a.B.Street != "main" || a.B.C.Zip != "34000" {
+		t.Errorf("Transform should trim all string fields, got: %+v", a)
+	}
+
+	if a.Count != 2 || a.B.Lines[0] != " a " {
+		t.Errorf("Transform should not modify other fields, got: %+v", a)
+	}
+
+	expected := []string{"Name", "Count", "Street", "Zip", "Lines", "Created"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Transform should visit the leaf fields %v, got: %v", expected, visited)
+	}
+}
+
+func TestTransform_Errors(t *testing.T) {
+	type A struct {
+		Name  string
+		Count int
+	}
+
+	fn := func(f *Field) (interface{}, bool) {
+		return "value", true
+	}
+
+	if err := New(A{}).Transform(fn); !errors.Is(err, ErrNotSettable) {
+		t.Errorf("Transform should return ErrNotSettable for a non pointer, got: %v", err)
+	}
+
+	a := &A{}
+	if err := New(a).Transform(fn); err == nil || !strings.Contains(err.Error(), "Count") {
+		t.Errorf("Transform should return an error for a mismatched type, got: %v", err)
+	}
+}
+
+func TestSettableFields(t *testing.T) {
+	type A struct {
+		Name   string
+		Email  string
+		Skip   string `structs:"-"`
+		secret string
+	}
+
+	a := &A{secret: "secret"}
+
+	var names []string
+	for _, f := range New(a).SettableFields() {
+		names = append(names, f.Name())
+	}
+
+	if expected := []string{"Name", "Email"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("SettableFields should return %v, got: %v", expected, names)
+	}
+
+	if fields := New(*a).SettableFields(); len(fields) != 0 {
+		t.Errorf("SettableFields should return no fields for a non pointer, got: %d", len(fields))
+	}
+}
+
+func TestNonZeroFields(t *testing.T) {
+	type Address struct {
+		City string
+		Zip  string
+	}
+
+	type User struct {
+		ID      int
+		Name    string
+		Email   *string
+		Active  bool
+		Tags    []string
+		Address Address
+		Skip    string `structs:"-"`
+	}
+
+	u := User{Name: "example", Tags: []string{}, Address: Address{City: "Paris"}, Skip: "skip"}
+
+	var names []string
+	for _, f := range New(u).NonZeroFields() {
+		names = append(names, f.Name())
+	}
+
+	if expected := []string{"Name", "Tags", "Address"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("NonZeroFields should return %v, got: %v", expected, names)
+	}
+
+	names = nil
+	for _, f := range New(u.Address).NonZeroFields() {
+		names = append(names, f.Name())
+	}
+
+	if expected := []string{"City"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("NonZeroFields should return %v for the nested struct, got: %v", expected, names)
+	}
+}
+
+func TestNonZeroLeafFields(t *testing.T) {
+	type Geo struct {
+		Lat float64
+		Lng float64
+	}
+
+	type Address struct {
+		City string
+		Zip  string
+		Geo  *Geo
+	}
+
+	type User struct {
+		Name    string
+		Created time.Time
+		Address Address
+		Billing *Address
+	}
+
+	u := User{
+		Name:    "example",
+		Created: time.Unix(0, 0),
+		Address: Address{City: "Paris", Geo: &Geo{Lat: 48.85}},
+	}
+
+	var names []string
+	for _, f := range New(u).NonZeroLeafFields() {
+		names = append(names, f.Name())
+	}
+
+	if expected := []string{"Name", "Created", "City", "Lat"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("NonZeroLeafFields should return %v, got: %v", expected, names)
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	type Geo struct {
+		Lat float64
+		Lng float64
+	}
+
+	type Address struct {
+		City string
+		Geo  *Geo
+	}
+
+	type Person struct {
+		Name    string
+		Address Address
+	}
+
+	p := &Person{Name: "example"}
+	s := New(p)
+
+	if err := s.SetPath("Address.Geo.Lat", 48.85); err != nil {
+		t.Fatalf("SetPath should not return an error, got: %s", err)
+	}
+
+	if p.Address.Geo == nil || p.Address.Geo.Lat != 48.85 {
+		t.Errorf("SetPath should allocate Geo and set Lat, got: %+v", p.Address.Geo)
+	}
+
+	if err := s.SetPath("Address.City", "Paris"); err != nil || p.Address.City != "Paris" {
+		t.Errorf("SetPath should set City, got: %q, %v", p.Address.City, err)
+	}
+
+	if err := s.SetPath("Address.Geo.Lat", "north"); err == nil {
+		t.Error("SetPath should return an error for a mismatched type")
+	}
+
+	if err := s.SetPath("Address.Zip", 1); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("SetPath should return ErrFieldNotFound, got: %v", err)
+	}
+
+	if err := s.SetPath("Name.First", "a"); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("SetPath should return ErrNotStruct, got: %v", err)
+	}
+
+	if err := New(Person{}).SetPath("Name", "a"); !errors.Is(err, ErrNotSettable) {
+		t.Errorf("SetPath should return ErrNotSettable for a non pointer, got: %v", err)
+	}
+}
+
+func TestKeyPath(t *testing.T) {
+	type Meta struct {
+		Version int `structs:"version"`
+	}
+
+	type Address struct {
+		Zip  string `structs:"zip_code"`
+		City string
+	}
+
+	type User struct {
+		Name    string   `structs:"name"`
+		Address *Address `structs:"address"`
+		Meta    `structs:",flatten"`
+	}
+
+	s := New(User{})
+	s.Rename("Name", "full_name")
+
+	tests := map[string]string{
+		"Name":         "full_name",
+		"Address":      "address",
+		"Address.Zip":  "address.zip_code",
+		"Address.City": "address.City",
+		"Meta.Version": "version",
+	}
+
+	for path, expected := range tests {
+		if key, ok := s.KeyPath(path); !ok || key != expected {
+			t.Errorf("KeyPath(%q) should return %q, got: %q, %v", path, expected, key, ok)
+		}
+	}
+
+	for _, path := range []string{"Missing", "Address.Missing", "Name.Zip", "Meta", ""} {
+		if key, ok := s.KeyPath(path); ok {
+			t.Errorf("KeyPath(%q) should return false, got: %q", path, key)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package structs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Fingerprint returns a stable SHA-256 hex digest of the struct's content as
+// returned by Map. The content is hashed in its canonical JSON form, where
+// map keys are sorted, so equal content always gives the same fingerprint
+// regardless of map iteration order. Unexported and omitted fields don't
+// contribute. An error is returned if the content can't be serialized.
+func (s *Struct) Fingerprint() (string, error) {
+	return digest(s.Map())
+}
+
+// digest returns the SHA-256 hex digest of the canonical JSON form of m.
+func digest(m map[string]interface{}) (string, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checksum returns the checksum of m computed with ChecksumFunc, or its
+// digest if ChecksumFunc is not set. The digest of content that can't be
+// serialized is empty.
+func (s *Struct) checksum(m map[string]interface{}) string {
+	if s.ChecksumFunc != nil {
+		return s.ChecksumFunc(m)
+	}
+
+	sum, _ := digest(m)
+	return sum
+}
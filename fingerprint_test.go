@@ -0,0 +1,138 @@
+package structs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	type B struct {
+		Tags map[string]int
+	}
+
+	type A struct {
+		Name  string
+		Port  int
+		B     B
+		Skip  string `structs:"-"`
+		inner string
+	}
+
+	newA := func() A {
+		return A{
+			Name: "example",
+			Port: 80,
+			B:    B{Tags: map[string]int{"a": 1, "b": 2, "c": 3}},
+		}
+	}
+
+	a1, a2 := newA(), newA()
+	a2.Skip = "ignored"
+	a2.inner = "ignored"
+
+	f1, err := New(a1).Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint should not return an error, got: %s", err)
+	}
+
+	f2, err := New(a2).Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint should not return an error, got: %s", err)
+	}
+
+	if f1 != f2 {
+		t.Errorf("Fingerprint of equal structs should be equal, got: %s and %s", f1, f2)
+	}
+
+	a2.B.Tags["b"] = 20
+
+	f3, err := New(a2).Fingerprint()
+	if err != nil {
+		t.Fatalf("Fingerprint should not return an error, got: %s", err)
+	}
+
+	if f1 == f3 {
+		t.Errorf("Fingerprint should change when a field changes, got: %s", f3)
+	}
+}
+
+func TestFingerprint_Error(t *testing.T) {
+	type A struct {
+		C chan int
+	}
+
+	type B struct {
+		Name string
+		C    chan int
+	}
+
+	// channels are skipped by Map, so they don't affect the fingerprint
+	if _, err := New(A{C: make(chan int)}).Fingerprint(); err != nil {
+		t.Errorf("Fingerprint should skip channel fields, got: %v", err)
+	}
+
+	f1, _ := New(B{Name: "example", C: make(chan int)}).Fingerprint()
+	f2, _ := New(B{Name: "example"}).Fingerprint()
+	if f1 != f2 {
+		t.Errorf("Fingerprint should not depend on channel fields, got: %s and %s", f1, f2)
+	}
+
+	type F struct {
+		F float64
+	}
+
+	if _, err := New(F{F: math.NaN()}).Fingerprint(); err == nil {
+		t.Error("Fingerprint should return an error for unserializable content")
+	}
+}
+
+func TestMap_Checksum(t *testing.T) {
+	type B struct {
+		Tags map[string]int `structs:"tags"`
+	}
+
+	type A struct {
+		Name     string `structs:"name"`
+		B        B      `structs:"b"`
+		Checksum string `structs:"checksum"`
+	}
+
+	a := A{Name: "example", B: B{Tags: map[string]int{"a": 1, "b": 2, "c": 3}}, Checksum: "stale"}
+
+	s := New(a)
+	s.ChecksumKey = "checksum"
+
+	m := s.Map()
+
+	expected, err := digest(map[string]interface{}{
+		"name": "example",
+		"b":    map[string]interface{}{"tags": map[string]int{"c": 3, "b": 2, "a": 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["checksum"] != expected {
+		t.Errorf("Map should add the checksum %s, got: %v", expected, m["checksum"])
+	}
+
+	if _, ok := m["b"].(map[string]interface{})["checksum"]; ok {
+		t.Error("Map should not add the checksum to nested structs")
+	}
+
+	for i := 0; i < 10; i++ {
+		if sum := s.Map()["checksum"]; sum != expected {
+			t.Fatalf("Map should return a stable checksum %s, got: %v", expected, sum)
+		}
+	}
+
+	s.ChecksumFunc = func(m map[string]interface{}) string {
+		if _, ok := m["checksum"]; ok {
+			t.Error("ChecksumFunc should not be given the checksum key")
+		}
+		return "custom"
+	}
+
+	if sum := s.Map()["checksum"]; sum != "custom" {
+		t.Errorf("Map should use ChecksumFunc, got: %v", sum)
+	}
+}
@@ -0,0 +1,114 @@
+package structs
+
+import (
+	"reflect"
+	"sort"
+)
+
+// FrozenMap is a read-only snapshot of the output of Map, as returned by
+// Freeze. Nested maps of the output are FrozenMaps as well, and slices and
+// other maps are copied, so neither later changes to the struct nor changes
+// to the values returned by Get affect the snapshot. Pointers are not
+// followed and still refer to the original values.
+type FrozenMap struct {
+	m map[string]interface{}
+}
+
+// Freeze returns a FrozenMap of the current output of Map, ie: for caching
+// the serialization of a struct.
+func (s *Struct) Freeze() FrozenMap {
+	return freeze(s.Map())
+}
+
+func freeze(m map[string]interface{}) FrozenMap {
+	f := FrozenMap{m: make(map[string]interface{}, len(m))}
+	for k, v := range m {
+		f.m[k] = copyValue(v)
+	}
+
+	return f
+}
+
+// Get returns the value of the given key and whether the key is present.
+// Nested maps are returned as FrozenMap and slices and other maps as
+// copies.
+func (f FrozenMap) Get(key string) (interface{}, bool) {
+	v, ok := f.m[key]
+	if !ok {
+		return nil, false
+	}
+
+	return copyValue(v), true
+}
+
+// Keys returns the keys of the map in sorted order.
+func (f FrozenMap) Keys() []string {
+	keys := make([]string, 0, len(f.m))
+	for k := range f.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Len returns the number of keys of the map.
+func (f FrozenMap) Len() int {
+	return len(f.m)
+}
+
+// copyValue returns a deep copy of the slices and maps in val, with
+// map[string]interface{} values frozen.
+func copyValue(val interface{}) interface{} {
+	if m, ok := val.(map[string]interface{}); ok {
+		return freeze(m)
+	}
+
+	return copyContainer(reflect.ValueOf(val))
+}
+
+// copyContainer returns a deep copy of the slice or map v, keeping its type,
+// or v as is if it's neither.
+func copyContainer(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyElem(v.Index(i)))
+		}
+		return c.Interface()
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, copyElem(v.MapIndex(k)))
+		}
+		return c.Interface()
+	case reflect.Invalid:
+		return nil
+	}
+
+	return v.Interface()
+}
+
+// copyElem returns a copy of the element v of a slice or map. Elements of
+// interface types are copied with copyValue, other elements keep their
+// type, ie: the maps of a []map[string]interface{}.
+func copyElem(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Interface {
+		return reflect.ValueOf(copyContainer(v))
+	}
+
+	if v.IsNil() {
+		return v
+	}
+
+	return reflect.ValueOf(copyValue(v.Interface()))
+}
@@ -0,0 +1,82 @@
+package structs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	type B struct {
+		Tags []string `structs:"tags"`
+	}
+
+	type A struct {
+		Name  string         `structs:"name"`
+		Ports map[string]int `structs:"ports"`
+		B     B              `structs:"b"`
+		Items []B            `structs:"items"`
+	}
+
+	a := &A{
+		Name:  "example",
+		Ports: map[string]int{"http": 80},
+		B:     B{Tags: []string{"a"}},
+		Items: []B{{Tags: []string{"x"}}},
+	}
+
+	f := New(a).Freeze()
+
+	a.Name = "changed"
+	a.Ports["http"] = 8080
+	a.B.Tags[0] = "changed"
+	a.Items[0].Tags[0] = "changed"
+
+	if expected := []string{"b", "items", "name", "ports"}; !reflect.DeepEqual(f.Keys(), expected) || f.Len() != 4 {
+		t.Errorf("Freeze should have the keys %v, got: %v", expected, f.Keys())
+	}
+
+	if name, _ := f.Get("name"); name != "example" {
+		t.Errorf("Freeze should keep the name, got: %v", name)
+	}
+
+	ports, _ := f.Get("ports")
+	if ports.(map[string]int)["http"] != 80 {
+		t.Errorf("Freeze should copy maps, got: %v", ports)
+	}
+	ports.(map[string]int)["http"] = 1
+
+	if ports, _ := f.Get("ports"); ports.(map[string]int)["http"] != 80 {
+		t.Errorf("Get should return copies of maps, got: %v", ports)
+	}
+
+	b, ok := f.Get("b")
+	if !ok {
+		t.Fatal("Freeze should have the b key")
+	}
+
+	tags, _ := b.(FrozenMap).Get("tags")
+	if !reflect.DeepEqual(tags, []string{"a"}) {
+		t.Errorf("Freeze should freeze nested maps and copy slices, got: %v", tags)
+	}
+
+	items, _ := f.Get("items")
+	tags, _ = items.([]interface{})[0].(FrozenMap).Get("tags")
+	if !reflect.DeepEqual(tags, []string{"x"}) {
+		t.Errorf("Freeze should freeze maps in slices, got: %v", tags)
+	}
+
+	s := New(a)
+	s.TypedSliceMaps = true
+
+	f = s.Freeze()
+	items, _ = f.Get("items")
+	items.([]map[string]interface{})[0]["tags"] = nil
+
+	if items, _ := f.Get("items"); items.([]map[string]interface{})[0]["tags"] == nil {
+		t.Error("Get should return copies of typed slices of maps")
+	}
+
+	if _, ok := f.Get("missing"); ok {
+		t.Error("Get should return false for a missing key")
+	}
+}
@@ -0,0 +1,107 @@
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// EqualsJSON reports whether the struct's content as returned by Map equals
+// the given JSON document. Both are compared in their decoded JSON form, so
+// key order doesn't matter and numbers are compared by value, ie: int 1
+// equals 1.0. The same tag rules as Map apply, ie: fields omitted with
+// omitempty must not be in the document. An error is returned if the
+// content can't be serialized or the document can't be parsed.
+func (s *Struct) EqualsJSON(jsonBytes []byte) (bool, error) {
+	b, err := json.Marshal(s.Map())
+	if err != nil {
+		return false, err
+	}
+
+	var got, expected interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(jsonBytes, &expected); err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(got, expected), nil
+}
+
+// EncodeSlice writes the given slice or array of structs or pointers to
+// structs to w as a JSON array, converting and encoding one element at a
+// time with Map and the given options, ie: for exporting many rows with
+// bounded memory. Nil pointers are written as null. An error is returned if
+// slice is not a slice or array of structs, or if an element can't be
+// encoded or written. Elements written before the error are not undone.
+func EncodeSlice(w io.Writer, slice interface{}, opts ...Option) error {
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("not slice: %T", slice)
+	}
+
+	elem := v.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %s", ErrNotStruct, v.Type().Elem())
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+
+		var m map[string]interface{}
+		if e := v.Index(i); e.Kind() != reflect.Ptr || !e.IsNil() {
+			m = New(e.Interface(), opts...).Map()
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("%d: %w", i, err)
+		}
+
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// FieldSizes returns the approximate number of bytes every top level key of
+// Map contributes to its JSON encoding, ie: to find oversized fields in
+// large payloads. The size of a key is the length of its quoted key and of
+// its encoded value. Values which can't be encoded as JSON are estimated by
+// their length when formatted with fmt.Sprint.
+func (s *Struct) FieldSizes() map[string]int {
+	m := s.Map()
+	out := make(map[string]int, len(m))
+
+	for k, v := range m {
+		size := len(k) + 3 // the quotes and the colon
+
+		if b, err := json.Marshal(v); err == nil {
+			size += len(b)
+		} else {
+			size += len(fmt.Sprint(v))
+		}
+
+		out[k] = size
+	}
+
+	return out
+}
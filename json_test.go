@@ -0,0 +1,122 @@
+package structs
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEqualsJSON(t *testing.T) {
+	type address struct {
+		City string  `structs:"city"`
+		Lat  float64 `structs:"lat"`
+	}
+
+	type person struct {
+		Name    string   `structs:"name"`
+		Age     int      `structs:"age"`
+		Nick    string   `structs:"nick,omitempty"`
+		Tags    []string `structs:"tags"`
+		Address address  `structs:"address"`
+	}
+
+	p := person{
+		Name:    "example",
+		Age:     30,
+		Tags:    []string{"a", "b"},
+		Address: address{City: "Paris", Lat: 48},
+	}
+
+	tests := []struct {
+		doc      string
+		expected bool
+	}{
+		{`{"address": {"lat": 48.0, "city": "Paris"}, "tags": ["a", "b"], "age": 30.0, "name": "example"}`, true},
+		{`{"name": "example", "age": 30, "tags": ["b", "a"], "address": {"city": "Paris", "lat": 48}}`, false},
+		{`{"name": "example", "age": 30, "nick": "", "tags": ["a", "b"], "address": {"city": "Paris", "lat": 48}}`, false},
+		{`{"name": "example", "age": 30, "tags": ["a", "b"], "address": {"city": "Rome", "lat": 48}}`, false},
+	}
+
+	for _, test := range tests {
+		equal, err := New(p).EqualsJSON([]byte(test.doc))
+		if err != nil {
+			t.Fatalf("EqualsJSON should not return an error, got: %s", err)
+		}
+
+		if equal != test.expected {
+			t.Errorf("EqualsJSON(%s) should return %t, got: %t", test.doc, test.expected, equal)
+		}
+	}
+
+	if _, err := New(p).EqualsJSON([]byte(`{`)); err == nil {
+		t.Error("EqualsJSON should return an error for an invalid document")
+	}
+}
+
+func TestEncodeSlice(t *testing.T) {
+	type row struct {
+		ID   int    `structs:"id"`
+		Name string `structs:"name,omitempty"`
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeSlice(&buf, []*row{{ID: 1, Name: "a"}, {ID: 2}, nil}); err != nil {
+		t.Fatalf("EncodeSlice should not return an error, got: %s", err)
+	}
+
+	if expected := `[{"id":1,"name":"a"},{"id":2},null]`; buf.String() != expected {
+		t.Errorf("EncodeSlice should write %s, got: %s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := EncodeSlice(&buf, []row{}, WithOmitEmpty()); err != nil || buf.String() != "[]" {
+		t.Errorf("EncodeSlice should write an empty array, got: %s, %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := EncodeSlice(&buf, [2]row{{ID: 1}, {ID: 0, Name: "b"}}, WithOmitEmpty()); err != nil ||
+		buf.String() != `[{"id":1},{"name":"b"}]` {
+		t.Errorf("EncodeSlice should apply the options, got: %s, %v", buf.String(), err)
+	}
+
+	if err := EncodeSlice(&buf, []int{1}); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("EncodeSlice should return ErrNotStruct for a slice of ints, got: %v", err)
+	}
+
+	if err := EncodeSlice(&buf, row{}); err == nil {
+		t.Error("EncodeSlice should return an error for a non slice")
+	}
+}
+
+func TestFieldSizes(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		ID          int    `structs:"id"`
+		Description string `structs:"description"`
+		B           B      `structs:"b"`
+		Empty       string `structs:"empty,omitempty"`
+	}
+
+	a := A{ID: 7, Description: strings.Repeat("a", 100), B: B{Name: "x"}}
+
+	sizes := New(a).FieldSizes()
+
+	expected := map[string]int{
+		"id":          len(`"id":7`),
+		"description": len(`"description":""`) + 100,
+		"b":           len(`"b":{"Name":"x"}`),
+	}
+
+	if !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("FieldSizes should return %v, got: %v", expected, sizes)
+	}
+
+	if sizes["description"] <= sizes["id"] {
+		t.Errorf("FieldSizes should report a larger size for the long string, got: %v", sizes)
+	}
+}
@@ -0,0 +1,50 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// KVPairs returns a flat map[string]string of the struct, suitable for
+// pushing into key/value stores such as Consul or etcd. Keys are the
+// slash-joined path to every leaf value, starting with prefix, and slice
+// elements are addressed by their index, ie: "prefix/addr/city" or
+// "prefix/tags/0", or as formatted by IndexFormat if set. Keys containing a
+// '/' are escaped if EscapePathKeys is set. Leaf values are formatted with
+// fmt.Sprint. The same tag rules as Map apply.
+func (s *Struct) KVPairs(prefix string) map[string]string {
+	out := make(map[string]string)
+	s.flattenKV(out, prefix, s.Map())
+	return out
+}
+
+// flattenKV walks val and writes every leaf into out under its slash-joined
+// key.
+func (s *Struct) flattenKV(out map[string]string, key string, val interface{}) {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			s.flattenKV(out, joinKV(key, s.pathKey(fmt.Sprint(k.Interface()), "/")), v.MapIndex(k).Interface())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			s.flattenKV(out, s.indexKey(key, i, joinKV), v.Index(i).Interface())
+		}
+	case reflect.Invalid:
+		out[key] = fmt.Sprint(val)
+	default:
+		out[key] = fmt.Sprint(v.Interface())
+	}
+}
+
+func joinKV(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
@@ -0,0 +1,98 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestKVPairs(t *testing.T) {
+	type address struct {
+		City    string `structs:"city"`
+		Country string `structs:"country,omitempty"`
+	}
+
+	type config struct {
+		Name string   `structs:"name"`
+		Addr address  `structs:"addr"`
+		Tags []string `structs:"tags"`
+		Port int      `structs:"port"`
+	}
+
+	c := config{
+		Name: "app",
+		Addr: address{City: "Istanbul"},
+		Tags: []string{"a", "b"},
+		Port: 8080,
+	}
+
+	kv := New(c).KVPairs("prefix")
+
+	expected := map[string]string{
+		"prefix/name":      "app",
+		"prefix/addr/city": "Istanbul",
+		"prefix/tags/0":    "a",
+		"prefix/tags/1":    "b",
+		"prefix/port":      "8080",
+	}
+
+	if !reflect.DeepEqual(kv, expected) {
+		t.Errorf("KVPairs should return %v, got: %v", expected, kv)
+	}
+}
+
+func TestKVPairs_NestedSlice(t *testing.T) {
+	type server struct {
+		Host string `structs:"host"`
+	}
+
+	type config struct {
+		Servers []server `structs:"servers"`
+	}
+
+	c := config{Servers: []server{{Host: "a"}, {Host: "b"}}}
+
+	kv := New(c).KVPairs("")
+
+	expected := map[string]string{
+		"servers/0/host": "a",
+		"servers/1/host": "b",
+	}
+
+	if !reflect.DeepEqual(kv, expected) {
+		t.Errorf("KVPairs should return %v, got: %v", expected, kv)
+	}
+}
+
+func TestKVPairs_IndexFormat(t *testing.T) {
+	type server struct {
+		Tags []string `structs:"tags"`
+	}
+
+	type config struct {
+		Servers []server `structs:"servers"`
+	}
+
+	s := New(config{Servers: []server{{Tags: []string{"a", "b"}}}})
+	s.IndexFormat = func(base string, i int) string {
+		return fmt.Sprintf("%s[%d]", base, i)
+	}
+
+	expected := map[string]string{
+		"servers[0]/tags[0]": "a",
+		"servers[0]/tags[1]": "b",
+	}
+
+	if kv := s.KVPairs(""); !reflect.DeepEqual(kv, expected) {
+		t.Errorf("KVPairs should return %v, got: %v", expected, kv)
+	}
+
+	records := []Record{
+		{Path: "servers[0].tags[0]", Value: "a"},
+		{Path: "servers[0].tags[1]", Value: "b"},
+	}
+
+	if r := s.Records(); !reflect.DeepEqual(r, records) {
+		t.Errorf("Records should return %v, got: %v", records, r)
+	}
+}
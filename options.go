@@ -0,0 +1,69 @@
+package structs
+
+import "unicode"
+
+// Option configures a *Struct. Options are passed to New.
+type Option func(*Struct)
+
+// WithTagName sets the struct field tag name used to look up keys and
+// options, ie: "json".
+func WithTagName(tagName string) Option {
+	return func(s *Struct) {
+		s.TagName = tagName
+	}
+}
+
+// WithOmitEmpty omits all zero value fields. See Struct.OmitEmpty.
+func WithOmitEmpty() Option {
+	return func(s *Struct) {
+		s.OmitEmpty = true
+	}
+}
+
+// WithFlatten merges nested structs into their parent. See Struct.Flatten.
+func WithFlatten() Option {
+	return func(s *Struct) {
+		s.Flatten = true
+	}
+}
+
+// WithKeyTransform transforms the keys of fields without an explicit tag
+// name. See Struct.KeyTransform.
+func WithKeyTransform(fn func(string) string) Option {
+	return func(s *Struct) {
+		s.KeyTransform = fn
+	}
+}
+
+// SnakeCase converts a Go field name to snake case, for use as a
+// KeyTransform. Acronyms are kept as a single word, ie: "HTTPServer" is
+// converted to "http_server" and "UserID" to "user_id".
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	out := make([]rune, 0, len(runes)+4)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+
+	return string(out)
+}
+
+// MapWith is the same as Map, but applies the given options for this call
+// only, without modifying s. It's safe to call MapWith concurrently with
+// different options on the same *Struct.
+func (s *Struct) MapWith(opts ...Option) map[string]interface{} {
+	n := *s
+	for _, opt := range opts {
+		opt(&n)
+	}
+
+	return n.Map()
+}
@@ -0,0 +1,262 @@
+package structs
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNew_Options(t *testing.T) {
+	type B struct {
+		Host string `json:"host"`
+		Port int
+	}
+
+	type A struct {
+		Name  string `json:"name"`
+		Empty string
+		Inner B
+	}
+
+	a := A{Name: "example", Inner: B{Host: "localhost"}}
+
+	s := New(a,
+		WithTagName("json"),
+		WithOmitEmpty(),
+		WithFlatten(),
+		WithKeyTransform(strings.ToLower),
+	)
+
+	if s.TagName != "json" || !s.OmitEmpty || !s.Flatten || s.KeyTransform == nil {
+		t.Fatalf("New should apply all options, got: %+v", s)
+	}
+
+	expected := map[string]interface{}{"name": "example", "host": "localhost"}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should return %v, got: %v", expected, m)
+	}
+}
+
+func TestNew_NoOptions(t *testing.T) {
+	type A struct {
+		Name string `json:"name"`
+	}
+
+	s := New(A{})
+
+	if s.TagName != DefaultTagName || s.OmitEmpty || s.Flatten || s.KeyTransform != nil {
+		t.Errorf("New without options should use the defaults, got: %+v", s)
+	}
+}
+
+func TestMap_OmitEmptyGlobal(t *testing.T) {
+	type A struct {
+		Name  string
+		Value string
+		Count int
+	}
+
+	s := New(A{Name: "example"})
+	s.OmitEmpty = true
+
+	expected := map[string]interface{}{"Name": "example"}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should omit all empty fields, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_FlattenGlobal(t *testing.T) {
+	type C struct {
+		Deep string
+	}
+
+	type B struct {
+		Name string
+		C    C
+	}
+
+	type A struct {
+		B    B
+		Tags map[string]string
+	}
+
+	s := New(A{B: B{Name: "example", C: C{Deep: "deep"}}, Tags: map[string]string{"a": "b"}})
+	s.Flatten = true
+
+	expected := map[string]interface{}{
+		"Name": "example",
+		"Deep": "deep",
+		"Tags": map[string]string{"a": "b"},
+	}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should flatten all nested structs, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_FlattenDepth(t *testing.T) {
+	type D struct {
+		Code string
+	}
+
+	type C struct {
+		Zip string
+		D   D
+	}
+
+	type B struct {
+		City string
+		C    C
+	}
+
+	type A struct {
+		Name string
+		B    B
+	}
+
+	a := A{Name: "example", B: B{City: "Istanbul", C: C{Zip: "34000", D: D{Code: "TR"}}}}
+
+	s := New(a)
+	s.Flatten = true
+	s.FlattenDepth = 1
+
+	expected := map[string]interface{}{
+		"Name": "example",
+		"City": "Istanbul",
+		"C": map[string]interface{}{
+			"Zip": "34000",
+			"D":   map[string]interface{}{"Code": "TR"},
+		},
+	}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should flatten only the first level, expected %v, got: %v", expected, m)
+	}
+
+	s.FlattenDepth = 2
+	expected = map[string]interface{}{
+		"Name": "example",
+		"City": "Istanbul",
+		"Zip":  "34000",
+		"D":    map[string]interface{}{"Code": "TR"},
+	}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should flatten two levels, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestDecode_FlattenDepth(t *testing.T) {
+	type C struct {
+		Z string
+	}
+
+	type B struct {
+		City string
+		C    C
+	}
+
+	type A struct {
+		Name string
+		B    B
+	}
+
+	a := A{Name: "example", B: B{City: "Istanbul", C: C{Z: "34000"}}}
+
+	for _, depth := range []int{1, 2} {
+		s := New(a)
+		s.Flatten = true
+		s.FlattenDepth = depth
+
+		var decoded A
+		d := New(&decoded)
+		d.Flatten = true
+		d.FlattenDepth = depth
+
+		if err := d.Decode(s.Map()); err != nil {
+			t.Fatalf("Decode should not return an error, got: %s", err)
+		}
+
+		if !reflect.DeepEqual(decoded, a) {
+			t.Errorf("Decode with FlattenDepth %d should round trip %+v, got: %+v", depth, a, decoded)
+		}
+	}
+}
+
+func TestMap_KeyTransform(t *testing.T) {
+	type A struct {
+		Name  string `structs:"Renamed"`
+		Value string
+	}
+
+	s := New(A{Name: "a", Value: "b"})
+	s.KeyTransform = strings.ToUpper
+
+	expected := map[string]interface{}{"Renamed": "a", "VALUE": "b"}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should transform untagged keys only, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMapWith(t *testing.T) {
+	type A struct {
+		Name string `json:"json_name" xml:"xml_name"`
+	}
+
+	s := New(A{Name: "example"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+			m := s.MapWith(WithTagName("json"))
+			if m["json_name"] != "example" || len(m) != 1 {
+				t.Errorf("MapWith should use the json tag, got: %v", m)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			m := s.MapWith(WithTagName("xml"))
+			if m["xml_name"] != "example" || len(m) != 1 {
+				t.Errorf("MapWith should use the xml tag, got: %v", m)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.TagName != DefaultTagName {
+		t.Errorf("MapWith should not modify the receiver, got tag name: %s", s.TagName)
+	}
+
+	if m := s.Map(); m["Name"] != "example" {
+		t.Errorf("Map should still use the default tag, got: %v", m)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":         "name",
+		"ID":           "id",
+		"URL":          "url",
+		"UserID":       "user_id",
+		"HTTPServer":   "http_server",
+		"UserIDNumber": "user_id_number",
+		"Base64Value":  "base64_value",
+	}
+
+	for name, expected := range tests {
+		if got := SnakeCase(name); got != expected {
+			t.Errorf("SnakeCase(%q) should return %q, got: %q", name, expected, got)
+		}
+	}
+
+	type A struct {
+		HTTPServer string
+	}
+
+	m := New(A{HTTPServer: "a"}, WithKeyTransform(SnakeCase)).Map()
+	if _, ok := m["http_server"]; !ok {
+		t.Errorf("Map should use SnakeCase as a KeyTransform, got: %v", m)
+	}
+}
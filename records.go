@@ -0,0 +1,58 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Record is a single leaf value of a struct and its dotted path, as returned
+// by Records.
+type Record struct {
+	Path  string
+	Value interface{}
+}
+
+// Records returns every leaf value of the struct as a flat list of
+// path/value records, ie: for long-format CSV. Paths are the dotted keys to
+// the leaf, with slice elements and map values addressed by their index or
+// key, ie: "addr.city" or "tags.0", or as formatted by IndexFormat if set.
+// Keys containing a '.' are escaped if EscapePathKeys is set. Records of
+// maps are sorted by key and records of slices by index. The same tag rules
+// as Map apply.
+func (s *Struct) Records() []Record {
+	var records []Record
+	s.flattenRecords(&records, "", s.Map())
+	return records
+}
+
+func (s *Struct) flattenRecords(records *[]Record, path string, val interface{}) {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		for _, k := range v.MapKeys() {
+			key := fmt.Sprint(k.Interface())
+			keys = append(keys, key)
+			values[key] = v.MapIndex(k)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s.flattenRecords(records, joinPath(path, s.pathKey(key, ".")), values[key].Interface())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			s.flattenRecords(records, s.indexKey(path, i, joinPath), v.Index(i).Interface())
+		}
+	case reflect.Invalid:
+		*records = append(*records, Record{Path: path, Value: val})
+	default:
+		*records = append(*records, Record{Path: path, Value: v.Interface()})
+	}
+}
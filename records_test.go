@@ -0,0 +1,81 @@
+package structs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecords(t *testing.T) {
+	type address struct {
+		City    string `structs:"city"`
+		Country string `structs:"country,omitempty"`
+	}
+
+	type user struct {
+		Name string   `structs:"name"`
+		Addr address  `structs:"addr"`
+		Tags []string `structs:"tags"`
+		Age  *int     `structs:"age"`
+	}
+
+	age := 30
+	u := user{
+		Name: "example",
+		Addr: address{City: "Istanbul"},
+		Tags: []string{"a", "b"},
+		Age:  &age,
+	}
+
+	expected := []Record{
+		{Path: "addr.city", Value: "Istanbul"},
+		{Path: "age", Value: 30},
+		{Path: "name", Value: "example"},
+		{Path: "tags.0", Value: "a"},
+		{Path: "tags.1", Value: "b"},
+	}
+
+	if records := New(u).Records(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("Records should return %v, got: %v", expected, records)
+	}
+}
+
+func TestRecords_EscapePathKeys(t *testing.T) {
+	type A struct {
+		Labels map[string]interface{} `structs:"labels"`
+	}
+
+	a := A{Labels: map[string]interface{}{
+		"a.b": "dotted",
+		"a":   map[string]string{"b": "nested"},
+		`c\d`: "backslash",
+	}}
+
+	s := New(a)
+
+	expected := []Record{
+		{Path: "labels.a.b", Value: "nested"},
+		{Path: "labels.a.b", Value: "dotted"},
+		{Path: `labels.c\d`, Value: "backslash"},
+	}
+
+	if records := s.Records(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("Records should join keys as is by default, expected %v, got: %v", expected, records)
+	}
+
+	s.EscapePathKeys = true
+
+	expected = []Record{
+		{Path: "labels.a.b", Value: "nested"},
+		{Path: `labels.a\.b`, Value: "dotted"},
+		{Path: `labels.c\\d`, Value: "backslash"},
+	}
+
+	if records := s.Records(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("Records should escape keys containing the separator, expected %v, got: %v", expected, records)
+	}
+
+	kv := s.KVPairs("")
+	if kv["labels/a.b"] != "dotted" || kv["labels/a/b"] != "nested" || kv[`labels/c\\d`] != "backslash" {
+		t.Errorf("KVPairs should escape keys containing the separator, got: %v", kv)
+	}
+}
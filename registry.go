@@ -0,0 +1,64 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// TypeRegistry maps names to struct types for decoding maps holding a
+// discriminator, ie: {"type": "circle", ...}, into the matching concrete
+// struct. The zero value is an empty registry ready to use. It's safe to use
+// a TypeRegistry concurrently.
+type TypeRegistry struct {
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+}
+
+// Register registers the struct type of prototype, which may be a struct or
+// a pointer to a struct, under the given name. It panics if the prototype's
+// kind is not struct.
+func (r *TypeRegistry) Register(name string, prototype interface{}) {
+	t := structType(prototype)
+	if t == nil || t.Kind() != reflect.Struct {
+		panic("not struct")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.types == nil {
+		r.types = make(map[string]reflect.Type)
+	}
+	r.types[name] = t
+}
+
+// Decode looks up the type registered under the name found in m at
+// discriminatorKey, allocates a new instance of it and fills it from m with
+// Struct.Decode. It returns a pointer to the new instance, ie: *Circle. An
+// error is returned if the discriminator is missing or not registered.
+func (r *TypeRegistry) Decode(m map[string]interface{}, discriminatorKey string) (interface{}, error) {
+	name, ok := m[discriminatorKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing discriminator %q", discriminatorKey)
+	}
+
+	r.mu.RLock()
+	t, ok := r.types[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("type %q is not registered", name)
+	}
+
+	s, err := NewFromType(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Decode(m); err != nil {
+		return nil, err
+	}
+
+	return s.Interface(), nil
+}
@@ -0,0 +1,118 @@
+package structs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypeRegistry(t *testing.T) {
+	type circle struct {
+		Type   string  `structs:"type"`
+		Radius float64 `structs:"radius"`
+	}
+
+	type rect struct {
+		Type   string `structs:"type"`
+		Width  int    `structs:"width"`
+		Height int    `structs:"height"`
+	}
+
+	var r TypeRegistry
+	r.Register("circle", circle{})
+	r.Register("rect", &rect{})
+
+	c, err := r.Decode(map[string]interface{}{"type": "circle", "radius": 1.5}, "type")
+	if err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	if expected := (&circle{Type: "circle", Radius: 1.5}); !reflect.DeepEqual(c, expected) {
+		t.Errorf("Decode should return %+v, got: %+v", expected, c)
+	}
+
+	rc, err := r.Decode(map[string]interface{}{"type": "rect", "width": 2.0, "height": 3}, "type")
+	if err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	if expected := (&rect{Type: "rect", Width: 2, Height: 3}); !reflect.DeepEqual(rc, expected) {
+		t.Errorf("Decode should return %+v, got: %+v", expected, rc)
+	}
+}
+
+func TestTypeRegistry_Errors(t *testing.T) {
+	type circle struct {
+		Radius float64
+	}
+
+	var r TypeRegistry
+	r.Register("circle", circle{})
+
+	if _, err := r.Decode(map[string]interface{}{"Radius": 1}, "type"); err == nil {
+		t.Error("Decode should return an error for a missing discriminator")
+	}
+
+	if _, err := r.Decode(map[string]interface{}{"type": "square"}, "type"); err == nil {
+		t.Error("Decode should return an error for an unregistered type")
+	}
+
+	if _, err := r.Decode(map[string]interface{}{"type": "circle", "Radius": "big"}, "type"); err == nil {
+		t.Error("Decode should return an error for a mismatched field type")
+	}
+
+	defer func() {
+		if err := recover(); err == nil {
+			t.Error("Register should panic for a non struct prototype")
+		}
+	}()
+
+	r.Register("int", 1)
+}
+
+func TestMap_TypeKey(t *testing.T) {
+	type Address struct {
+		City string `structs:"city"`
+	}
+
+	type User struct {
+		Name    string  `structs:"name"`
+		Address Address `structs:"address"`
+	}
+
+	u := User{Name: "example", Address: Address{City: "Paris"}}
+
+	s := New(u)
+	s.TypeKey = "_type"
+
+	expected := map[string]interface{}{
+		"_type":   "User",
+		"name":    "example",
+		"address": map[string]interface{}{"city": "Paris"},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should add the type name, expected %v, got: %v", expected, m)
+	}
+
+	if kvs := s.OrderedMap(); kvs[0].Key != "_type" {
+		t.Errorf("OrderedMap should add the type name first, got: %v", kvs)
+	}
+
+	if !s.WillEmit("_type") {
+		t.Error("WillEmit should report the type key")
+	}
+
+	s.TypeName = "user"
+
+	var r TypeRegistry
+	r.Register("user", User{})
+
+	decoded, err := r.Decode(s.Map(), "_type")
+	if err != nil {
+		t.Fatalf("Decode should not return an error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, &u) {
+		t.Errorf("Decode should round trip %+v, got: %+v", u, decoded)
+	}
+}
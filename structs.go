@@ -2,9 +2,18 @@
 package structs
 
 import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -12,27 +21,421 @@ var (
 	// a more granular to tweak certain structs. Lookup the necessary functions
 	// for more info.
 	DefaultTagName = "structs" // struct's field default tag name
+
+	// DefaultRedactWith is the default value secret fields are replaced with
+	// by MapRedacted.
+	DefaultRedactWith = "***"
+
+	// ErrNotStruct is returned when a struct is expected but a value or type
+	// of a different kind is given.
+	ErrNotStruct = errors.New("not struct")
+
+	// ErrFieldNotFound is returned when a field with the given name does not
+	// exist or can't be accessed.
+	ErrFieldNotFound = errors.New("field not found")
+
+	// ErrNotSettable is returned when the fields of a struct are modified,
+	// but the *Struct was not created with a pointer.
+	ErrNotSettable = errors.New("struct is not settable")
+
+	// ErrUnsupportedKind is returned by MapE in Strict mode for fields whose
+	// values can't be serialized, ie: funcs and channels, and for fields
+	// with the join option which aren't slices of scalars.
+	ErrUnsupportedKind = errors.New("unsupported kind")
+
+	// ErrDuplicateKey is returned by MapE for keys emitted by more than one
+	// field with the DuplicateError policy.
+	ErrDuplicateKey = errors.New("duplicate key")
 )
 
+// FieldError is the error of a single field, ie: as returned by Decode or by
+// MapE. Path is the dotted path of keys from the root struct
+// to the field, with slice elements and map values addressed by their index
+// or key, ie: "servers.0.port".
+type FieldError struct {
+	Path   string
+	GoName string
+	Key    string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Path, e.GoName, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// withPrefix prefixes the Path of a *FieldError, or the message of any other
+// error, with prefix.
+func withPrefix(prefix string, err error) error {
+	if fe, ok := err.(*FieldError); ok {
+		n := *fe
+		n.Path = joinPath(prefix, fe.Path)
+		return &n
+	}
+
+	return fmt.Errorf("%s: %w", prefix, err)
+}
+
 // tagOptions contains a slice of tag options
 type tagOptions []string
 
+// KeyValue is a single key and value of a struct's output, as returned by
+// OrderedMap.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// DuplicateKeyPolicy decides which value is emitted for a key emitted by
+// more than one field, ie: after flattening or a KeyTransform.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeepLast emits the value of the last field in declaration
+	// order.
+	DuplicateKeepLast DuplicateKeyPolicy = iota
+
+	// DuplicateKeepFirst emits the value of the first field in declaration
+	// order.
+	DuplicateKeepFirst
+
+	// DuplicateError makes MapE return an error. Map emits the value of the
+	// last field as with DuplicateKeepLast.
+	DuplicateError
+
+	// DuplicateSuffix emits the value of every field, with the Go name of
+	// the originating field appended to the key of all but the first one,
+	// ie: "Name_OtherStruct" for the Name field of a flattened OtherStruct
+	// field. If a suffixed key is still taken, the last value is emitted as
+	// with DuplicateKeepLast.
+	DuplicateSuffix
+)
+
 // Struct encapsulates a struct type to provide several high level functions
-// around the struct.
+// around the struct. A Struct holds no state other than its settings, so its
+// read methods, ie: Map, Values and OrderedMap, are safe to call from
+// multiple goroutines as long as neither the Struct's settings nor the
+// underlying struct are modified concurrently, ie: with Rename or Decode.
 type Struct struct {
 	raw     interface{}
 	value   reflect.Value
 	TagName string
+
+	// TagOptionSeparator separates the name and the options of a tag. It
+	// defaults to ',' and can be changed to allow commas in option values,
+	// ie: `structs:"name;default=a,b;omitempty"` for ';'.
+	TagOptionSeparator rune
+
+	// KnownOptions are the custom tag options, in addition to the built-in
+	// ones, which ValidateTags accepts, ie: "section" for `section=basic`.
+	KnownOptions []string
+
+	// OnDuplicateKey is the policy for keys emitted by more than one field,
+	// including the fields of flattened structs. It defaults to
+	// DuplicateKeepLast.
+	OnDuplicateKey DuplicateKeyPolicy
+
+	// EnumTables maps a field's tag name to a table of names for its integer
+	// values. Fields with a table are emitted by their looked up name instead
+	// of the integer. Values missing from the table are emitted as is.
+	EnumTables map[string]map[int]string
+
+	// Labels maps a field's tag name to a table of labels for its values.
+	// Fields tagged with labeled and a label for their value are emitted as
+	// a map of both, ie: {"value": 2, "label": "Active"}. Values of named
+	// integer and string types may be looked up by their underlying value,
+	// ie: 2 for a `type Status int`.
+	Labels map[string]map[interface{}]string
+
+	// Formatters maps a field's tag name to a func which returns the value
+	// emitted for the field, given its value, ie: to mask part of an email.
+	// Formatters take precedence over the type based conversions, ie:
+	// EnumTables, UseErrorString and the marshalers, and over the string,
+	// json, as and flatten tag options.
+	Formatters map[string]func(interface{}) interface{}
+
+	// OmitEmpty omits all zero value fields, as if every field was tagged
+	// with omitempty. Fields tagged with keepempty are always included.
+	OmitEmpty bool
+
+	// Flatten merges the fields of all nested structs into their parent, as
+	// if every struct field was tagged with flatten.
+	Flatten bool
+
+	// FlattenDepth, if positive, limits Flatten to the structs nested up to
+	// the given depth, ie: 1 merges only the fields of the direct nested
+	// structs, while deeper structs are kept as nested maps. Fields tagged
+	// with flatten are merged regardless.
+	FlattenDepth int
+
+	// KeyTransform, if set, transforms the Go field name of fields without
+	// an explicit tag name into their key, ie: strings.ToLower.
+	KeyTransform func(string) string
+
+	// Compact drops nil values, empty strings and empty slices and maps from
+	// the output, recursing into nested maps and slices, regardless of the
+	// field tags. Nested maps and slices left empty after dropping their
+	// values are dropped too, so only populated leaves remain.
+	Compact bool
+
+	// NilSliceAsEmpty emits nil slices as empty slices instead of nil. Slices
+	// of scalars keep their type, ie: []int{}, and slices of structs are
+	// emitted with the type of non-empty ones, ie: []interface{}{}. By
+	// default nil slices are emitted as nil slices of their type.
+	NilSliceAsEmpty bool
+
+	// EmptySliceAsNull emits empty non-nil slices as nil slices of the same
+	// type, which serialize to JSON null, ie: for schemas where a missing
+	// list and an empty one are the same. Nil slices are left to
+	// NilSliceAsEmpty. By default empty slices are emitted as empty slices,
+	// with the same type as non-empty ones, which serialize to [].
+	EmptySliceAsNull bool
+
+	// NilMapAsEmpty emits nil maps as empty maps instead of nil. Maps of
+	// scalars keep their type, ie: map[string]int{}, and maps of structs are
+	// emitted as map[string]interface{}{}.
+	NilMapAsEmpty bool
+
+	// SkipKinds skips all fields whose type is of one of the given kinds,
+	// regardless of their tags, ie: reflect.Ptr to skip all pointer fields.
+	SkipKinds []reflect.Kind
+
+	// LeafTypes are struct types whose values are emitted as is instead of
+	// being converted to maps. Structs without exported fields, ie:
+	// time.Time, are always emitted as is, but types embedding them, ie:
+	// `type MyTime struct{ time.Time }`, are converted like any other struct
+	// and emit the embedded value under its type name, ie: "Time", unless
+	// they are leaf types.
+	LeafTypes []reflect.Type
+
+	// TypedSliceMaps emits slices and arrays whose elements are all
+	// converted to maps, ie: []StructType, as []map[string]interface{}
+	// instead of []interface{}.
+	TypedSliceMaps bool
+
+	// ShouldRecurse, if set, is called for every field of a struct or
+	// pointer to struct type. If it returns false, the field is not
+	// converted, as if it was tagged with omitnested.
+	ShouldRecurse func(f *Field) bool
+
+	// OmitEmptyNested omits all fields of a struct or pointer to struct type
+	// whose value is zero, ie: a nil pointer or a struct whose fields are all
+	// zero, without having to tag them with omitempty. Fields tagged with
+	// keepempty are always included.
+	OmitEmptyNested bool
+
+	// OmitEmptyDereferences makes omitempty dereference pointers and omit the
+	// field if the pointed to value is zero, ie: a *int pointing to 0. By
+	// default only nil pointers are omitted, as with encoding/json.
+	OmitEmptyDereferences bool
+
+	// VirtualFields adds extra keys to the output, whose values are computed
+	// by calling the function with the struct value, ie: a User rather than
+	// a *User. Keys of real fields take precedence over virtual fields.
+	// Virtual fields are not added to nested structs.
+	VirtualFields map[string]func(interface{}) interface{}
+
+	// DedupPointers emits pointers to structs which appear more than once in
+	// the output, ie: in two fields, converted only once. The first
+	// occurrence is converted with an additional "$id" key, a number unique
+	// within the output, and the later ones are emitted as {"$ref": id}.
+	// This also allows converting cyclic values. The struct itself is not
+	// tracked.
+	DedupPointers bool
+
+	// TypeKey, if set, adds the TypeName of the struct under the given key
+	// as the first key, ie: "_type", as a discriminator for polymorphic
+	// output. Nested structs don't get a TypeKey.
+	TypeKey string
+
+	// TypeName is the value added under TypeKey. It defaults to the Go type
+	// name of the struct, ie: "User".
+	TypeName string
+
+	// ChecksumKey, if set, adds a checksum of the output of Map under the
+	// given key. The checksum is computed over the rest of the output, which
+	// replaces a field with the same key, with ChecksumFunc, or as the
+	// SHA-256 hex digest of its canonical JSON form if ChecksumFunc is not
+	// set, ie: the same as Fingerprint. Nested structs don't get a checksum.
+	ChecksumKey string
+
+	// ChecksumFunc computes the checksum added under ChecksumKey.
+	ChecksumFunc func(map[string]interface{}) string
+
+	// RedactWith is the value fields tagged with secret are replaced with by
+	// MapRedacted.
+	RedactWith string
+
+	// IndexFormat, if set, formats the keys of slice and array elements from
+	// the key of the slice and the element's index for KVPairs and Records,
+	// ie: "tags[0]". By default these join the index as any other key, ie:
+	// "tags.0" for Records.
+	IndexFormat func(base string, i int) string
+
+	// EscapePathKeys escapes the separator, and the escape character '\'
+	// itself, with a '\' in the keys joined into the paths of Records and
+	// KVPairs, so a map key like "a.b" doesn't collide with the key "b"
+	// nested in "a", ie: "labels.a\.b" for Records.
+	EscapePathKeys bool
+
+	// NullValue is emitted instead of nil values, ie: nil pointers,
+	// interfaces, slices and maps, including the nil values of slices and
+	// maps of structs. It defaults to nil. Fields omitted with omitempty are
+	// still omitted.
+	NullValue interface{}
+
+	// redact replaces secret fields with RedactWith if set.
+	redact bool
+
+	// TimeLocation, if set, converts all emitted time.Time values to the
+	// given location, ie: time.UTC.
+	TimeLocation *time.Location
+
+	// TimeFormat, if set, emits all time.Time values as strings formatted
+	// with the given layout, ie: time.RFC3339, after converting them to
+	// TimeLocation. Decode parses strings into time.Time fields with it, or
+	// with time.RFC3339Nano if it's not set.
+	TimeFormat string
+
+	// UseJSONMarshaler emits the values of types implementing json.Marshaler,
+	// with either a value or a pointer receiver, as the json.RawMessage
+	// returned by their MarshalJSON method. time.Time values are kept as is.
+	// Values whose MarshalJSON returns an error are converted as usual.
+	// Marshalers with a pointer receiver are only found for addressable
+	// values, ie: if the *Struct was created with a pointer, and not for map
+	// values.
+	UseJSONMarshaler bool
+
+	// UseTextMarshaler emits the values of types implementing
+	// encoding.TextMarshaler, with either a value or a pointer receiver, as
+	// the string returned by their MarshalText method, ie: net.IP. It takes
+	// precedence over UseJSONMarshaler. time.Time values are kept as is.
+	// Values whose MarshalText returns an error are converted as usual.
+	// Marshalers with a pointer receiver are only found for addressable
+	// values, ie: if the *Struct was created with a pointer, and not for map
+	// values.
+	UseTextMarshaler bool
+
+	// UseGetters emits the value returned by a field's getter method instead
+	// of the field's value, if the struct has one. The getter of a field
+	// Name is a method GetName without arguments and a single return value.
+	// Getters with a pointer receiver are only found if the *Struct was
+	// created with a pointer.
+	UseGetters bool
+
+	// UseErrorString emits the values of fields whose type implements error
+	// as the string returned by their Error method. Nil errors are emitted
+	// as nil.
+	UseErrorString bool
+
+	// NormalizeNumbers emits all integer values as int64 and all float values
+	// as float64, including named types, ie: time.Duration, and the elements
+	// of slices and arrays of numbers, which are emitted as []int64 and
+	// []float64. Unsigned values larger than math.MaxInt64 and []byte values
+	// are kept as is.
+	NormalizeNumbers bool
+
+	// Strict makes MapE return an error listing the fields of unsupported
+	// kinds, ie: funcs, channels and unsafe pointers, including the fields
+	// of nested structs. Otherwise these fields are skipped silently. It also
+	// makes ApplyPatch return an error for keys without a field.
+	Strict bool
+
+	// NumberCoercion is the policy for setting numbers of a different type
+	// than the field's with Decode. It defaults to NumberStrict.
+	NumberCoercion NumberCoercion
+
+	// IncludeFunc, if set, is called for every field, including the fields
+	// of nested structs, with the context given to MapContext. If it returns
+	// false, the field is omitted. Other methods call it with
+	// context.Background().
+	IncludeFunc func(ctx context.Context, f *Field) bool
+
+	// refs holds the ids of the pointers seen with DedupPointers.
+	refs map[uintptr]int
+
+	// depth is the nesting depth of the struct, 0 for the struct itself.
+	depth int
+
+	// ctx is the context given to MapContext.
+	ctx context.Context
+
+	// renames holds the keys set with Rename, by Go field name.
+	renames map[string]string
+
+	// walk keeps nested structs as *Struct instead of maps, for Walk.
+	walk bool
+
+	// goNames ignores the tags except for "-" and secret, for GoNameMap.
+	goNames bool
+}
+
+// New returns a new *Struct with the struct s, configured with the given
+// options. It panics if the s's kind is not struct.
+func New(s interface{}, opts ...Option) *Struct {
+	st := &Struct{
+		raw:                s,
+		value:              strctVal(s),
+		TagName:            DefaultTagName,
+		TagOptionSeparator: ',',
+		RedactWith:         DefaultRedactWith,
+	}
+
+	for _, opt := range opts {
+		opt(st)
+	}
+
+	return st
+}
+
+// NewFromType returns a new *Struct wrapping a newly allocated zero value of
+// the struct type t. The returned *Struct is settable and the allocated
+// value can be retrieved with Interface. An error is returned if t is not a
+// struct or a pointer to a struct type.
+func NewFromType(t reflect.Type) (*Struct, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %v", ErrNotStruct, t)
+	}
+
+	return New(reflect.New(t).Interface()), nil
 }
 
-// New returns a new *Struct with the struct s. It panics if the s's kind is
-// not struct.
-func New(s interface{}) *Struct {
-	return &Struct{
-		raw:     s,
-		value:   strctVal(s),
-		TagName: DefaultTagName,
+// NewPointer is the same as New, but requires v to be a non-nil pointer to a
+// struct, so the returned *Struct is guaranteed to be settable, ie: for
+// Decode or SetPath. It returns an error wrapping ErrNotSettable if v is
+// not a pointer or is nil, and ErrNotStruct if it doesn't point to a
+// struct.
+func NewPointer(v interface{}) (*Struct, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("%w: %T is not a pointer", ErrNotSettable, v)
+	}
+
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%w: nil %s", ErrNotSettable, rv.Type())
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T", ErrNotStruct, v)
 	}
+
+	return New(v), nil
+}
+
+// Interface returns the underlying value the *Struct was created with.
+func (s *Struct) Interface() interface{} {
+	return s.raw
 }
 
 func strctVal(s interface{}) reflect.Value {
@@ -56,192 +459,1928 @@ func Map(s interface{}) map[string]interface{} {
 	return New(s).Map()
 }
 
+// MapValues converts every struct value of the given map, ie:
+// map[int]*User, with Map. The returned map is keyed by the original keys
+// formatted with fmt.Sprint. Nil pointer values are kept as nil. An error is
+// returned if m is not a map or its values are not structs or pointers to
+// structs.
+func MapValues(m interface{}) (map[string]interface{}, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("not map: %T", m)
+	}
+
+	elem := v.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	if elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %s", ErrNotStruct, v.Type().Elem())
+	}
+
+	out := make(map[string]interface{}, v.Len())
+	for _, k := range v.MapKeys() {
+		val := v.MapIndex(k)
+		key := fmt.Sprint(k.Interface())
+
+		if val.Kind() == reflect.Ptr && val.IsNil() {
+			out[key] = nil
+			continue
+		}
+
+		out[key] = Map(val.Interface())
+	}
+
+	return out, nil
+}
+
+// Project returns the fields of the struct src whose keys are present in
+// the struct shape, ie: a selection of fields driven by a Go type. Keys are
+// looked up by tag name, in the same way as Map, and keys missing from src,
+// ie: omitted with omitempty, are left out. shape may be a nil pointer, as
+// only its type is used. An error is returned if src or shape are not
+// structs.
+func Project(src interface{}, shape interface{}) (map[string]interface{}, error) {
+	if t := structType(src); t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T", ErrNotStruct, src)
+	}
+
+	sh, err := NewFromType(structType(shape))
+	if err != nil {
+		return nil, err
+	}
+
+	m := Map(src)
+	out := make(map[string]interface{})
+
+	for _, field := range sh.structFields() {
+		key := sh.fieldKey(field)
+		if val, ok := m[key]; ok {
+			out[key] = val
+		}
+	}
+
+	return out, nil
+}
+
 // Note that only exported fields of a struct can be accessed, non exported
-// fields will be neglected.
+// fields will be neglected. Slices, arrays and maps of scalars keep their
+// concrete type, ie: []string or a named `type Tags []string`.
 func (s *Struct) Map() map[string]interface{} {
 	out := make(map[string]interface{})
 	s.FillMap(out)
+
+	if s.Compact {
+		compact(out)
+	}
+
+	if s.ChecksumKey != "" {
+		delete(out, s.ChecksumKey)
+		out[s.ChecksumKey] = s.checksum(out)
+	}
+
 	return out
 }
 
-// FillMap is the same as Map. Instead of returning the output, it fills the
-// given map.
-func (s *Struct) FillMap(out map[string]interface{}) {
-	if out == nil {
-		return
+// MapE is the same as Map, but returns an error listing the fields whose
+// values can't be converted with the as tag option, the duplicate keys with
+// the DuplicateError policy, and if Strict is set the fields of unsupported
+// kinds instead of skipping them. Only the fields emitted by Map are
+// checked. The fields of nested structs, including the structs in slices
+// and maps, are listed with the keys of their parents, ie: "parent.child"
+// or "items.0.child".
+func (s *Struct) MapE() (map[string]interface{}, error) {
+	n := *s
+	if n.DedupPointers {
+		// the pointers checked so far, so cyclic values are checked once
+		n.refs = make(map[uintptr]int)
 	}
 
-	fields := s.structFields()
-
-	for _, field := range fields {
-		name := field.Name
-		val := s.value.FieldByName(name)
-		isSubStruct := false
-		var finalVal interface{}
+	if err := n.check(""); err != nil {
+		return nil, err
+	}
 
-		tagName, tagOpts := parseTag(field.Tag.Get(s.TagName))
-		if tagName != "" {
-			name = tagName
-		}
+	return s.Map(), nil
+}
 
-		// if the value is a zero value and the field is marked as omitempty do
-		// not include
-		if tagOpts.Has("omitempty") {
-			zero := reflect.Zero(val.Type()).Interface()
-			current := val.Interface()
+// check returns the joined errors of the fields MapE reports, with their
+// keys prefixed with prefix.
+func (s *Struct) check(prefix string) error {
+	var errs []error
 
-			if reflect.DeepEqual(current, zero) {
-				continue
+	if s.OnDuplicateKey == DuplicateError {
+		// the pointers seen by check are not shared with the conversion
+		d := *s
+		d.refs = nil
+		if _, err := d.dedupe(d.pairs()); err != nil {
+			if prefix != "" {
+				err = withPrefix(prefix, err)
 			}
+			errs = append(errs, err)
 		}
+	}
 
-		if !tagOpts.Has("omitnested") {
-			finalVal = s.nested(val)
+	for _, field := range s.structFields() {
+		// only the fields emitted by Map are checked
+		name, val, tagOpts, ok := s.lookup(field)
+		if !ok {
+			continue
+		}
 
-			v := reflect.ValueOf(val.Interface())
-			if v.Kind() == reflect.Ptr {
-				v = v.Elem()
-			}
+		key := joinPath(prefix, name)
+		fieldErr := func(err error) {
+			errs = append(errs, &FieldError{Path: key, GoName: field.Name, Key: name, Err: err})
+		}
 
-			switch v.Kind() {
-			case reflect.Map, reflect.Struct:
-				isSubStruct = true
+		if kind, ok := unsupportedKind(val); ok {
+			if s.Strict {
+				fieldErr(fmt.Errorf("%w %s", ErrUnsupportedKind, kind))
 			}
-		} else {
-			finalVal = val.Interface()
+			continue
 		}
 
-		if tagOpts.Has("string") {
-			s, ok := val.Interface().(fmt.Stringer)
-			if ok {
-				out[name] = s.String()
-			}
+		if s.omitted(val, tagOpts) {
 			continue
 		}
 
-		if isSubStruct && (tagOpts.Has("flatten")) {
-			for k := range finalVal.(map[string]interface{}) {
-				out[k] = finalVal.(map[string]interface{})[k]
+		if as, ok := tagOpts.Get("as"); ok {
+			if _, err := coerce(val.Interface(), as); err != nil {
+				fieldErr(err)
 			}
-		} else {
-			out[name] = finalVal
 		}
-	}
-}
-
-// structFields returns the exported struct fields for a given s struct. This
-// is a convenient helper method to avoid duplicate code in some of the
-// functions.
-func (s *Struct) structFields() []reflect.StructField {
-	t := s.value.Type()
 
-	var f []reflect.StructField
-
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		// we can't access the value of unexported fields
-		if field.PkgPath != "" {
-			continue
+		if sep, ok := tagOpts.Get("join"); ok {
+			if _, err := joinValues(val.Interface(), sep); err != nil {
+				fieldErr(err)
+			}
 		}
 
-		// don't check if it's omitted
-		if tag := field.Tag.Get(s.TagName); tag == "-" {
+		if tagOpts.Has("omitnested") {
 			continue
 		}
 
-		f = append(f, field)
+		errs = append(errs, s.checkValue(key, val, field, name)...)
 	}
 
-	return f
+	return errors.Join(errs...)
 }
 
-// nested retrieves recursively all types for the given value and returns the
-// nested value.
-func (s *Struct) nested(val reflect.Value) interface{} {
-	var finalVal interface{}
+// checkValue returns the errors of the structs in v, the value of the given
+// field or one of its elements, with their keys prefixed with key,
+// recursing into slices, arrays and maps which may hold structs as nested
+// does. If Strict is set, unsupported kinds in v are reported too.
+func (s *Struct) checkValue(key string, v reflect.Value, field reflect.StructField, name string) []error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+
+		// with DedupPointers, repeated pointers are emitted as references
+		if v.Kind() == reflect.Ptr && s.refs != nil {
+			if _, ok := s.refs[v.Pointer()]; ok {
+				return nil
+			}
+			s.refs[v.Pointer()] = len(s.refs) + 1
+		}
 
-	v := reflect.ValueOf(val.Interface())
-	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
 
+	unsupported := func(desc interface{}) []error {
+		if !s.Strict {
+			return nil
+		}
+		err := fmt.Errorf("%w %s", ErrUnsupportedKind, desc)
+		return []error{&FieldError{Path: key, GoName: field.Name, Key: name, Err: err}}
+	}
+
+	if kind, ok := unsupportedKind(v); ok {
+		return unsupported(kind)
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+
+		switch elem.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+			return unsupported(v.Type())
+		}
+	}
+
+	var errs []error
+
 	switch v.Kind() {
 	case reflect.Struct:
-		n := New(val.Interface())
-		n.TagName = s.TagName
-		m := n.Map()
+		if s.isLeaf(v.Type()) {
+			return nil
+		}
 
-		// do not add the converted value if there are no exported fields, ie:
-		// time.Time
-		if len(m) == 0 {
-			finalVal = val.Interface()
-		} else {
-			finalVal = m
+		if err := s.sub(v.Interface()).check(key); err != nil {
+			errs = append(errs, err)
 		}
 	case reflect.Map:
-		// get the element type of the map
-		mapElem := val.Type()
-		switch val.Type().Kind() {
-		case reflect.Ptr, reflect.Array, reflect.Map,
-			reflect.Slice, reflect.Chan:
-			mapElem = val.Type().Elem()
-			if mapElem.Kind() == reflect.Ptr {
-				mapElem = mapElem.Elem()
-			}
-		}
-
-		// only iterate over struct types, ie: map[string]StructType,
-		// map[string][]StructType,
-		if mapElem.Kind() == reflect.Struct ||
-			(mapElem.Kind() == reflect.Slice &&
-				mapElem.Elem().Kind() == reflect.Struct) {
-			m := make(map[string]interface{}, val.Len())
-			for _, k := range val.MapKeys() {
-				m[k.String()] = s.nested(val.MapIndex(k))
-			}
-			finalVal = m
-			break
+		if !hasStruct(v.Type().Elem()) {
+			return nil
+		}
+
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface()) })
+
+		for _, k := range keys {
+			errs = append(errs, s.checkValue(joinPath(key, fmt.Sprint(k.Interface())), v.MapIndex(k), field, name)...)
 		}
-		finalVal = val.Interface()
 	case reflect.Slice, reflect.Array:
-		if val.Type().Kind() == reflect.Interface {
-			finalVal = val.Interface()
-			break
+		if !hasStruct(v.Type().Elem()) {
+			return nil
 		}
-		if val.Type().Elem().Kind() != reflect.Struct &&
-			!(val.Type().Elem().Kind() == reflect.Ptr &&
-				val.Type().Elem().Elem().Kind() == reflect.Struct) {
-			finalVal = val.Interface()
-			break
+
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, s.checkValue(joinPath(key, strconv.Itoa(i)), v.Index(i), field, name)...)
 		}
+	}
+
+	return errs
+}
+
+// MapRedacted is the same as Map, except that the values of all fields
+// tagged with secret, including the fields of nested structs, are replaced
+// with RedactWith. ie:
+//
+//	// Password is emitted as "***"
+//	Password string `structs:"password,secret"`
+func (s *Struct) MapRedacted() map[string]interface{} {
+	n := *s
+	n.redact = true
+	return n.Map()
+}
+
+// MapContext is the same as Map, but calls IncludeFunc with ctx to decide
+// whether fields are included, ie: to hide fields based on a role stored in
+// ctx.
+func (s *Struct) MapContext(ctx context.Context) map[string]interface{} {
+	n := *s
+	n.ctx = ctx
+	return n.Map()
+}
+
+// context returns the context given to MapContext, or context.Background().
+func (s *Struct) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// GoNameMap is the same as Map, but ignores the names and options of the
+// struct tags and keys all fields, including the fields of nested structs,
+// by their Go field names. As the output is meant for tooling, fields
+// tagged with "-" are still skipped and the fields tagged with secret are
+// redacted as with MapRedacted. Renames and KeyTransform are ignored as
+// well, while the other settings of s still apply.
+func (s *Struct) GoNameMap() map[string]interface{} {
+	n := *s
+	n.goNames = true
+	n.redact = true
+	n.KeyTransform = nil
+	n.renames = nil
+	return n.Map()
+}
+
+// FillMap is the same as Map. Instead of returning the output, it fills the
+// given map.
+func (s *Struct) FillMap(out map[string]interface{}) {
+	if out == nil {
+		return
+	}
+
+	pairs, _ := s.dedupe(s.pairs())
+	for _, kv := range pairs {
+		out[kv.Key] = kv.Value
+	}
+}
 
-		slices := make([]interface{}, val.Len())
-		for x := 0; x < val.Len(); x++ {
-			slices[x] = s.nested(val.Index(x))
+// OrderedMap is the same as Map, but returns the keys and values in the
+// declaration order of the fields. The keys of flattened structs, and the
+// promoted fields of unexported embedded structs, appear at the position of
+// the embedding field in their own declaration order. The keys of flattened
+// maps are sorted. If a key appears more than once, it's kept at its first
+// position with the value chosen by OnDuplicateKey, as in Map. Nested values
+// are the same as in Map.
+func (s *Struct) OrderedMap() []KeyValue {
+	var pairs []KeyValue
+	for _, kv := range s.pairs() {
+		if s.Compact {
+			var empty bool
+			if kv.Value, empty = compactValue(kv.Value); empty {
+				continue
+			}
 		}
-		finalVal = slices
-	default:
-		finalVal = val.Interface()
+		pairs = append(pairs, kv)
 	}
 
-	return finalVal
+	out, _ := s.dedupe(pairs)
+	return out
 }
 
-// Has returns true if the given option is available in tagOptions
-func (t tagOptions) Has(opt string) bool {
-	for _, tagOpt := range t {
-		if tagOpt == opt {
-			return true
+// OrderedMapFunc is the same as OrderedMap, but returns the keys sorted
+// with the given less function. Keys for which neither is less than the
+// other keep their declaration order. Only the top level keys are sorted,
+// nested values are the same as in Map.
+func (s *Struct) OrderedMapFunc(less func(a, b string) bool) []KeyValue {
+	out := s.OrderedMap()
+	sort.SliceStable(out, func(i, j int) bool { return less(out[i].Key, out[j].Key) })
+	return out
+}
+
+// Walk calls fn with the key and value of every pair returned by
+// OrderedMap, stopping at the first error, which is returned. Unlike
+// OrderedMap, nested structs, including those held in slices, arrays and
+// maps, are passed as a *Struct sharing the configuration of s rather than
+// converted into maps, so other representations can be built from the
+// struct directly by walking them in turn.
+func (s *Struct) Walk(fn func(key string, value interface{}) error) error {
+	n := *s
+	n.walk = true
+
+	for _, kv := range n.OrderedMap() {
+		if kv.Key == s.ChecksumKey {
+			continue
+		}
+		if err := fn(kv.Key, kv.Value); err != nil {
+			return err
 		}
 	}
 
-	return false
+	if s.ChecksumKey != "" {
+		// the checksum is computed over the output of Map
+		return fn(s.ChecksumKey, s.Map()[s.ChecksumKey])
+	}
+	return nil
 }
 
-// parseTag splits a struct field's tag into its name and a list of options
-// which comes after a name. A tag is in the form of: "name,option1,option2".
-// The name can be neglectected.
-func parseTag(tag string) (string, tagOptions) {
-	res := strings.Split(tag, ",")
-	return res[0], res[1:]
+// dedupe returns the pairs with every key kept at its first position with
+// the value chosen by OnDuplicateKey. With DuplicateError, an error for the
+// first duplicate key is returned along with the pairs of DuplicateKeepLast.
+func (s *Struct) dedupe(pairs []KeyValue) ([]KeyValue, error) {
+	var (
+		out []KeyValue
+		err error
+	)
+	index := make(map[string]int, len(pairs))
+
+	for _, kv := range pairs {
+		i, ok := index[kv.Key]
+		if !ok {
+			index[kv.Key] = len(out)
+			out = append(out, kv)
+			continue
+		}
+
+		switch s.OnDuplicateKey {
+		case DuplicateKeepFirst:
+			continue
+		case DuplicateError:
+			if err == nil {
+				err = fmt.Errorf("%w: %s", ErrDuplicateKey, kv.Key)
+			}
+		}
+
+		out[i].Value = kv.Value
+	}
+
+	return out, err
+}
+
+// WillEmit reports whether the output of Map contains the given key with the
+// current values and settings of s, ie: whether a field tagged with
+// omitempty is omitted. The keys are resolved without converting the
+// values, recursing into flattened structs. Since the keys then depend on
+// the converted values, the output is built as in OrderedMap if Compact or
+// DuplicateSuffix is set, or for maps tagged with flatten, which costs as
+// much as calling Map.
+func (s *Struct) WillEmit(key string) bool {
+	if s.ChecksumKey != "" && key == s.ChecksumKey || s.TypeKey != "" && key == s.TypeKey {
+		return true
+	}
+
+	if s.Compact || s.OnDuplicateKey == DuplicateSuffix {
+		return s.emitsKey(key)
+	}
+
+	for _, field := range s.structFields() {
+		name, val, tagOpts, ok := s.resolve(field)
+		if !ok {
+			continue
+		}
+
+		if lenKey, ok := tagOpts.Get("withlen"); ok && lenKey == key {
+			if _, ok := length(val); ok {
+				return true
+			}
+		}
+
+		// structs held in interfaces are flattened too
+		v := val
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			v = v.Elem()
+		}
+
+		if s.flattens(field, v, tagOpts) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+			if s.sub(v.Interface()).WillEmit(key) {
+				return true
+			}
+			continue
+		}
+
+		if tagOpts.Has("flatten") && reflect.Indirect(val).Kind() == reflect.Map {
+			return s.emitsKey(key)
+		}
+
+		if name == key && s.emitsName(name, val, tagOpts) {
+			return true
+		}
+	}
+
+	_, ok := s.VirtualFields[key]
+	return ok
+}
+
+// emitsName reports whether fieldPairs emits the value val under its key
+// name, without converting it. Only fields with the string option are
+// dropped, if their value is not a fmt.Stringer and it's not emitted in
+// another way first, ie: with a Formatter.
+func (s *Struct) emitsName(name string, val reflect.Value, tagOpts tagOptions) bool {
+	if !tagOpts.Has("string") {
+		return true
+	}
+
+	if _, ok := val.Interface().(fmt.Stringer); ok {
+		return true
+	}
+
+	if _, ok := s.Formatters[name]; ok || s.redact && tagOpts.Has("secret") {
+		return true
+	}
+
+	if tagOpts.Has("base64") && val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8 {
+		return true
+	}
+
+	if s.UseErrorString && val.Type().Implements(errorType) {
+		return true
+	}
+
+	if tagOpts.Has("labeled") {
+		if _, ok := s.label(name, val); ok {
+			return true
+		}
+	}
+
+	if table, ok := s.EnumTables[name]; ok {
+		if _, ok := enumName(table, val); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// emitsKey reports whether the output of OrderedMap contains key.
+func (s *Struct) emitsKey(key string) bool {
+	for _, kv := range s.OrderedMap() {
+		if kv.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SortedPairs returns the canonical form of the output of Map, where the
+// keys are sorted lexicographically at every level. Maps, including the
+// maps of nested structs and maps nested in slices, are converted to
+// []KeyValue sorted by key, with map keys formatted with fmt.Sprint. Nil
+// maps are nil. Other values are the same as in Map.
+func (s *Struct) SortedPairs() []KeyValue {
+	return canonical(reflect.ValueOf(s.Map())).([]KeyValue)
+}
+
+// canonical converts the maps in v to []KeyValue sorted by key, recursing
+// into slices and arrays.
+func canonical(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		out := make([]KeyValue, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			out = append(out, KeyValue{fmt.Sprint(k.Interface()), canonical(v.MapIndex(k))})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+		return out
+	case reflect.Slice, reflect.Array:
+		if k := v.Type().Elem().Kind(); k != reflect.Interface && k != reflect.Map {
+			break
+		}
+
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = canonical(v.Index(i))
+		}
+		return out
+	case reflect.Interface:
+		return canonical(v.Elem())
+	}
+
+	return v.Interface()
+}
+
+// pairs returns the keys and values of the fields of s in declaration order.
+// The same key might be returned more than once.
+func (s *Struct) pairs() []KeyValue {
+	// pointers are tracked across all nested structs of a single call
+	if s.DedupPointers && s.refs == nil {
+		n := *s
+		n.refs = make(map[uintptr]int)
+		return n.pairs()
+	}
+
+	var out []KeyValue
+
+	if s.TypeKey != "" {
+		out = append(out, KeyValue{s.TypeKey, s.typeName()})
+	}
+
+	// keys emitted so far, to suffix the keys of later fields with
+	// DuplicateSuffix
+	var seen map[string]bool
+	if s.OnDuplicateKey == DuplicateSuffix {
+		seen = make(map[string]bool)
+		for _, kv := range out {
+			seen[kv.Key] = true
+		}
+	}
+
+	fields := s.structFields()
+
+	for _, field := range fields {
+		name, val, tagOpts, ok := s.resolve(field)
+		if !ok {
+			continue
+		}
+
+		start := len(out)
+		out = s.fieldPairs(out, field, name, val, tagOpts)
+
+		// the length of the value might be emitted under its own key
+		if key, ok := tagOpts.Get("withlen"); ok {
+			if n, ok := length(val); ok {
+				out = append(out, KeyValue{key, n})
+			}
+		}
+
+		if seen != nil {
+			for i := start; i < len(out); i++ {
+				if seen[out[i].Key] {
+					out[i].Key += "_" + field.Name
+				}
+			}
+
+			for _, kv := range out[start:] {
+				seen[kv.Key] = true
+			}
+		}
+	}
+
+	return s.virtualPairs(out)
+}
+
+// fieldPairs appends the keys and values of the given field of s, with its
+// resolved key name, value and tag options, to out.
+func (s *Struct) fieldPairs(out []KeyValue, field reflect.StructField, name string, val reflect.Value, tagOpts tagOptions) []KeyValue {
+	isSubStruct := false
+	isStruct := false
+	var finalVal interface{}
+
+	if s.redact && tagOpts.Has("secret") {
+		return append(out, KeyValue{name, s.RedactWith})
+	}
+
+	// byte slices marked with base64 are emitted as encoded strings
+	if tagOpts.Has("base64") && val.Kind() == reflect.Slice &&
+		val.Type().Elem().Kind() == reflect.Uint8 {
+		return append(out, KeyValue{name, base64.StdEncoding.EncodeToString(val.Bytes())})
+	}
+
+	if format, ok := s.Formatters[name]; ok {
+		return append(out, KeyValue{name, format(val.Interface())})
+	}
+
+	// the value might come from a getter of a different type than the field
+	if s.UseErrorString && val.Type().Implements(errorType) {
+		return append(out, KeyValue{name, s.null(errorString(val))})
+	}
+
+	if tagOpts.Has("labeled") {
+		if label, ok := s.label(name, val); ok {
+			return append(out, KeyValue{name, map[string]interface{}{
+				"value": val.Interface(),
+				"label": label,
+			}})
+		}
+	}
+
+	if table, ok := s.EnumTables[name]; ok {
+		if enum, ok := enumName(table, val); ok {
+			return append(out, KeyValue{name, enum})
+		}
+	}
+
+	omitNested := tagOpts.Has("omitnested")
+	if !omitNested && s.ShouldRecurse != nil && isStructType(field.Type) {
+		omitNested = !s.ShouldRecurse(&Field{value: val, field: field, s: s})
+	}
+
+	if !omitNested {
+		ns := s
+		if s.walk && tagOpts.Has("json") {
+			// the json option marshals the nested structs as maps
+			c := *s
+			c.walk = false
+			ns = &c
+		}
+		finalVal = ns.nested(val)
+
+		v := reflect.ValueOf(val.Interface())
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			isStruct = true
+			isSubStruct = true
+		case reflect.Map:
+			isSubStruct = true
+		}
+	} else if t, ok := s.timeValue(val); ok {
+		finalVal = t
+	} else if isTypedNil(val) {
+		finalVal = nil
+	} else {
+		finalVal = val.Interface()
+	}
+
+	if s.NormalizeNumbers {
+		finalVal = normalizeNumbers(finalVal)
+	}
+
+	// round floats to the number of decimals given with the precision option
+	if p, ok := tagOpts.Get("precision"); ok {
+		if digits, err := strconv.Atoi(p); err == nil && digits >= 0 {
+			finalVal = round(finalVal, digits)
+		}
+	}
+
+	// join the elements of scalar slices with the join option
+	if sep, ok := tagOpts.Get("join"); ok {
+		if j, err := joinValues(val.Interface(), sep); err == nil {
+			finalVal = j
+		}
+	}
+
+	// coerce the value to the type given with the as option
+	if as, ok := tagOpts.Get("as"); ok {
+		if c, err := coerce(finalVal, as); err == nil {
+			finalVal = c
+		}
+	}
+
+	finalVal = s.null(finalVal)
+
+	if tagOpts.Has("string") {
+		s, ok := val.Interface().(fmt.Stringer)
+		if ok {
+			return append(out, KeyValue{name, s.String()})
+		}
+		return out
+	}
+
+	// emit the converted value pre-serialized as a JSON string
+	if tagOpts.Has("json") {
+		if b, err := json.Marshal(finalVal); err == nil {
+			return append(out, KeyValue{name, string(b)})
+		}
+	}
+
+	flatten := isSubStruct && tagOpts.Has("flatten") || isStruct && s.flatten()
+	m, ok := finalVal.(map[string]interface{})
+	_, walked := finalVal.(*Struct)
+	switch {
+	case (ok || walked) && flatten && isStruct:
+		// flattened structs keep the order of their fields
+		out = append(out, s.sub(val.Interface()).pairs()...)
+	case ok && flatten:
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			out = append(out, KeyValue{k, m[k]})
+		}
+	default:
+		out = append(out, KeyValue{name, finalVal})
+	}
+
+	return out
+}
+
+// refID returns the id of the pointer val with DedupPointers, whether it was
+// seen before, and false if val is not a pointer or pointers are not
+// tracked. Unseen pointers are assigned the next id.
+func (s *Struct) refID(val reflect.Value) (int, bool, bool) {
+	v := reflect.ValueOf(val.Interface())
+	if s.refs == nil || v.Kind() != reflect.Ptr || v.IsNil() {
+		return 0, false, false
+	}
+
+	if id, ok := s.refs[v.Pointer()]; ok {
+		return id, true, true
+	}
+
+	id := len(s.refs) + 1
+	s.refs[v.Pointer()] = id
+	return id, false, true
+}
+
+// typeName returns TypeName, or the Go type name of the struct if it's not
+// set.
+func (s *Struct) typeName() string {
+	if s.TypeName != "" {
+		return s.TypeName
+	}
+	return s.value.Type().Name()
+}
+
+// indexKey returns the key of the i-th element of the slice with the key
+// base, formatted with IndexFormat if set, or joined with join otherwise.
+func (s *Struct) indexKey(base string, i int, join func(prefix, key string) string) string {
+	if s.IndexFormat != nil {
+		return s.IndexFormat(base, i)
+	}
+	return join(base, strconv.Itoa(i))
+}
+
+// pathKey returns key escaped for a path joined with sep if EscapePathKeys
+// is set.
+func (s *Struct) pathKey(key, sep string) string {
+	if !s.EscapePathKeys || !strings.ContainsAny(key, sep+`\`) {
+		return key
+	}
+	return strings.NewReplacer(`\`, `\\`, sep, `\`+sep).Replace(key)
+}
+
+// resolve returns the key, value and tag options of the given field of s,
+// and false if the field is omitted regardless of its conversion, ie: by
+// IncludeFunc or omitempty.
+func (s *Struct) resolve(field reflect.StructField) (string, reflect.Value, tagOptions, bool) {
+	name, val, tagOpts, ok := s.lookup(field)
+	if !ok {
+		return "", reflect.Value{}, nil, false
+	}
+
+	// funcs and channels can't be serialized, MapE reports them in Strict
+	// mode
+	if _, ok := unsupportedKind(val); ok {
+		return "", reflect.Value{}, nil, false
+	}
+
+	if s.omitted(val, tagOpts) {
+		return "", reflect.Value{}, nil, false
+	}
+
+	return name, val, tagOpts, true
+}
+
+// lookup returns the key, value and tag options of the given field of s,
+// and false if the field is excluded by SkipKinds or IncludeFunc. The value
+// is the result of the field's getter with UseGetters.
+func (s *Struct) lookup(field reflect.StructField) (string, reflect.Value, tagOptions, bool) {
+	name := s.fieldKey(field)
+	val := s.value.FieldByIndex(field.Index)
+	_, tagOpts := s.parseTag(field)
+
+	if s.skipKind(field.Type.Kind()) {
+		return "", reflect.Value{}, nil, false
+	}
+
+	if s.IncludeFunc != nil && !s.IncludeFunc(s.context(), &Field{value: val, field: field, s: s}) {
+		return "", reflect.Value{}, nil, false
+	}
+
+	// the key might be taken from the value of a sibling field
+	if ref, ok := tagOpts.Get("keyfrom"); ok {
+		if key, ok := s.keyFrom(ref); ok {
+			name = key
+		}
+	}
+
+	if s.UseGetters {
+		if v, ok := s.getter(field.Name); ok {
+			val = v
+		}
+	}
+
+	return name, val, tagOpts, true
+}
+
+// omitted reports whether the field with the given value and tag options is
+// omitted because it's empty, ie: with omitempty or OmitEmptyNested.
+func (s *Struct) omitted(val reflect.Value, tagOpts tagOptions) bool {
+	// fields marked with keepempty are always included
+	if tagOpts.Has("keepempty") {
+		return false
+	}
+
+	// if the value is a zero value and the field is marked as omitempty do
+	// not include
+	if tagOpts.Has("omitempty") || s.OmitEmpty {
+		if null, ok := sqlNull(val); ok && null == nil {
+			return true
+		}
+
+		if isTypedNil(val) {
+			return true
+		}
+
+		if s.OmitEmptyDereferences && isZeroPointer(val) {
+			return true
+		}
+
+		zero := reflect.Zero(val.Type()).Interface()
+		current := val.Interface()
+
+		if reflect.DeepEqual(current, zero) {
+			return true
+		}
+	}
+
+	// nested structs are checked for zero values whether they are
+	// converted or not
+	return s.OmitEmptyNested && isStructType(val.Type()) && isZeroStruct(val)
+}
+
+// virtualPairs appends the VirtualFields of s, sorted by key, to out. Keys
+// already in out are not added.
+func (s *Struct) virtualPairs(out []KeyValue) []KeyValue {
+	if len(s.VirtualFields) == 0 {
+		return out
+	}
+
+	keys := make(map[string]bool, len(out))
+	for _, kv := range out {
+		keys[kv.Key] = true
+	}
+
+	virtual := make([]string, 0, len(s.VirtualFields))
+	for k := range s.VirtualFields {
+		if !keys[k] {
+			virtual = append(virtual, k)
+		}
+	}
+	sort.Strings(virtual)
+
+	for _, k := range virtual {
+		out = append(out, KeyValue{k, s.VirtualFields[k](s.value.Interface())})
+	}
+
+	return out
+}
+
+// Values converts the given struct to a []interface{}. For more info refer
+// to Struct types Values() method. It panics if s's kind is not struct.
+func Values(s interface{}) []interface{} {
+	return New(s).Values()
+}
+
+// Values converts the given s struct's field values to a []interface{}.
+// Values are always in the declaration order of the fields, regardless of
+// their tag names, so the output can be fed to positional encoders. The
+// values of nested structs are included in place, unless the field is
+// tagged with omitnested. A struct tag with the content of "-" ignores the
+// field and omitempty fields are skipped if their value is zero.
+func (s *Struct) Values() []interface{} {
+	return s.values(s.structFields(), false)
+}
+
+// OrderedValues is the same as Values, but returns the values in the order
+// given by the order option of the fields, ie: `structs:"name,order=2"`.
+// Fields are sorted by ascending order and followed by the fields without
+// an order, and fields with the same order keep their declaration order.
+// The values of nested structs are ordered by their own order options.
+func (s *Struct) OrderedValues() []interface{} {
+	fields := s.structFields()
+
+	// the order of every field by its Go name, missing for fields without one
+	order := make(map[string]int, len(fields))
+	for _, field := range fields {
+		_, tagOpts := s.parseTag(field)
+		if o, ok := tagOpts.Get("order"); ok {
+			if n, err := strconv.Atoi(o); err == nil {
+				order[field.Name] = n
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, okA := order[fields[i].Name]
+		b, okB := order[fields[j].Name]
+		if okA != okB {
+			return okA
+		}
+		return a < b
+	})
+
+	return s.values(fields, true)
+}
+
+// values returns the values of the given fields of s, with the values of
+// nested structs in the order of OrderedValues if ordered is set.
+func (s *Struct) values(fields []reflect.StructField, ordered bool) []interface{} {
+	var t []interface{}
+
+	for _, field := range fields {
+		val := s.value.FieldByIndex(field.Index)
+
+		_, tagOpts := s.parseTag(field)
+
+		if (tagOpts.Has("omitempty") || s.OmitEmpty) && !tagOpts.Has("keepempty") && (val.IsZero() || isTypedNil(val) ||
+			s.OmitEmptyDereferences && isZeroPointer(val)) {
+			continue
+		}
+
+		v := val
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+
+		// structs without exported fields, ie: time.Time, are values too
+		if v.Kind() == reflect.Struct && !tagOpts.Has("omitnested") {
+			if n := s.sub(v.Interface()); len(n.structFields()) > 0 {
+				if ordered {
+					t = append(t, n.OrderedValues()...)
+				} else {
+					t = append(t, n.Values()...)
+				}
+				continue
+			}
+		}
+
+		t = append(t, val.Interface())
+	}
+
+	return t
+}
+
+// ValueOr returns the value of the field with the given Go field name, or
+// key if no field has that Go name, if the field exists and its value is
+// not the zero value. Otherwise def is returned.
+func (s *Struct) ValueOr(name string, def interface{}) interface{} {
+	fields := s.structFields()
+
+	find := func(match func(reflect.StructField) bool) (reflect.Value, bool) {
+		for _, field := range fields {
+			if match(field) {
+				return s.value.FieldByIndex(field.Index), true
+			}
+		}
+		return reflect.Value{}, false
+	}
+
+	val, ok := find(func(f reflect.StructField) bool { return f.Name == name })
+	if !ok {
+		val, ok = find(func(f reflect.StructField) bool { return s.fieldKey(f) == name })
+	}
+
+	if !ok || val.IsZero() {
+		return def
+	}
+
+	return val.Interface()
+}
+
+// Has returns true if the struct has an exported field with the given Go
+// field name, ie: a field which can be retrieved with FieldOk. Fields
+// skipped with the "-" tag are not reported. Fields promoted from
+// unexported embedded structs are reported, while those of exported
+// embedded structs are only reachable through the embedded field.
+func (s *Struct) Has(name string) bool {
+	_, ok := s.FieldOk(name)
+	return ok
+}
+
+// HasTag returns true if the struct has a field which is emitted under the
+// given key, ie: the field's tag name or its Go field name if it has none.
+func (s *Struct) HasTag(tagName string) bool {
+	for _, field := range s.structFields() {
+		if s.fieldKey(field) == tagName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rename sets the key under which the field with the given Go field name is
+// emitted, overriding its tag name. It only applies to the fields of s, not
+// to the fields of nested structs. An error is returned if the field does
+// not exist.
+func (s *Struct) Rename(goFieldName, newKey string) error {
+	for _, field := range s.structFields() {
+		if field.Name != goFieldName {
+			continue
+		}
+
+		if s.renames == nil {
+			s.renames = make(map[string]string)
+		}
+		s.renames[goFieldName] = newKey
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrFieldNotFound, goFieldName)
+}
+
+// TagCrosswalk returns the keys of the fields for the tag name from mapped
+// to their keys for the tag name to, ie: to map "db" columns to "json"
+// keys. Keys are resolved as in Map, so fields without a tag use their Go
+// field name, after KeyTransform. Fields omitted with "-" for either tag
+// name are not included. Only the fields of s itself are mapped, nested
+// structs are not traversed.
+func (s *Struct) TagCrosswalk(from, to string) map[string]string {
+	src, dst := *s, *s
+	src.TagName, dst.TagName = from, to
+	src.renames, dst.renames = nil, nil
+
+	out := make(map[string]string)
+	for _, field := range src.structFields() {
+		if field.Tag.Get(to) == "-" {
+			continue
+		}
+
+		out[src.fieldKey(field)] = dst.fieldKey(field)
+	}
+
+	return out
+}
+
+// fieldKey returns the key under which the given field is emitted.
+func (s *Struct) fieldKey(field reflect.StructField) string {
+	if key, ok := s.renames[field.Name]; ok {
+		return key
+	}
+
+	if tagName, _ := s.parseTag(field); tagName != "" {
+		return tagName
+	}
+
+	if s.KeyTransform != nil {
+		return s.KeyTransform(field.Name)
+	}
+
+	return field.Name
+}
+
+// structFields returns the exported struct fields for a given s struct. This
+// is a convenient helper method to avoid duplicate code in some of the
+// functions.
+func (s *Struct) structFields() []reflect.StructField {
+	t := s.value.Type()
+	return s.typeFields(t, t, nil)
+}
+
+// typeFields returns the accessible fields of the struct type t, which is
+// found in root at the given index. Field indexes are relative to root.
+func (s *Struct) typeFields(root, t reflect.Type, index []int) []reflect.StructField {
+	var f []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		field.Index = append(append([]int{}, index...), i)
+
+		// don't check if it's omitted
+		if tag := field.Tag.Get(s.TagName); tag == "-" {
+			continue
+		}
+
+		// we can't access the value of unexported fields, but the exported
+		// fields of an unexported embedded struct are promoted and can be
+		// accessed through it
+		if field.PkgPath != "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				f = append(f, s.typeFields(root, field.Type, field.Index)...)
+			}
+			continue
+		}
+
+		// promoted fields might be shadowed by the fields of the outer struct
+		if len(index) > 0 {
+			sf, ok := root.FieldByName(field.Name)
+			if !ok || !reflect.DeepEqual(sf.Index, field.Index) {
+				continue
+			}
+		}
+
+		f = append(f, field)
+	}
+
+	return f
+}
+
+// sub returns a new *Struct for the nested struct v, sharing the
+// configuration of s, so the tags of nested structs, including anonymous
+// struct types, are parsed with the same TagName and TagOptionSeparator.
+func (s *Struct) sub(v interface{}) *Struct {
+	n := *s
+	n.raw = v
+	n.value = strctVal(v)
+	n.renames = nil
+	n.VirtualFields = nil
+	n.ChecksumKey = ""
+	n.TypeKey = ""
+	n.depth++
+	return &n
+}
+
+// flattens reports whether Map merges the fields of the struct, or pointer
+// to struct, val into the keys of s, as fieldPairs does. Leaf types,
+// sql.Null* types, marshalers used with UseTextMarshaler or
+// UseJSONMarshaler and structs without exported fields, ie: time.Time, are
+// emitted under their own key instead.
+func (s *Struct) flattens(field reflect.StructField, val reflect.Value, tagOpts tagOptions) bool {
+	if !tagOpts.Has("flatten") && !s.flatten() || tagOpts.Has("omitnested") {
+		return false
+	}
+
+	t := val.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || s.isLeaf(t) {
+		return false
+	}
+
+	v := reflect.New(t).Elem()
+	if _, ok := sqlNull(v); ok {
+		return false
+	}
+
+	if s.UseTextMarshaler {
+		if _, ok := asInterface(val, v, reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()); ok {
+			return false
+		}
+	}
+
+	if s.UseJSONMarshaler {
+		if _, ok := asInterface(val, v, reflect.TypeOf((*json.Marshaler)(nil)).Elem()); ok {
+			return false
+		}
+	}
+
+	if s.ShouldRecurse != nil && !s.ShouldRecurse(&Field{value: val, field: field, s: s}) {
+		return false
+	}
+
+	return len(s.sub(v.Addr().Interface()).structFields()) > 0
+}
+
+// flatten reports whether the nested structs of s are merged with Flatten,
+// limited by FlattenDepth.
+func (s *Struct) flatten() bool {
+	return s.Flatten && (s.FlattenDepth <= 0 || s.depth < s.FlattenDepth)
+}
+
+// keyFrom returns the value of the exported field with the given Go field
+// name, formatted with fmt.Sprint, to be used as a key.
+func (s *Struct) keyFrom(name string) (string, bool) {
+	field, ok := s.value.Type().FieldByName(name)
+	if !ok || field.PkgPath != "" {
+		return "", false
+	}
+
+	return fmt.Sprint(s.value.FieldByIndex(field.Index).Interface()), true
+}
+
+// getter calls the getter method of the field with the given Go field name
+// and returns its result, if s has one.
+func (s *Struct) getter(name string) (reflect.Value, bool) {
+	m := s.value.MethodByName("Get" + name)
+	if !m.IsValid() && s.value.CanAddr() {
+		m = s.value.Addr().MethodByName("Get" + name)
+	}
+
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return reflect.Value{}, false
+	}
+
+	return m.Call(nil)[0], true
+}
+
+// enumName looks up the name of the integer value val in the given table.
+func enumName(table map[int]string, val reflect.Value) (string, bool) {
+	var name string
+	var ok bool
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		name, ok = table[int(val.Int())]
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		name, ok = table[int(val.Uint())]
+	}
+
+	return name, ok
+}
+
+// nested retrieves recursively all types for the given value and returns the
+// nested value.
+func (s *Struct) nested(val reflect.Value) interface{} {
+	var finalVal interface{}
+
+	if isTypedNil(val) {
+		return nil
+	}
+
+	v := reflect.ValueOf(val.Interface())
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	if null, ok := sqlNull(v); ok {
+		return null
+	}
+
+	if t, ok := s.timeValue(v); ok {
+		return t
+	}
+
+	if s.UseTextMarshaler {
+		if text, ok := marshalText(val, v); ok {
+			return text
+		}
+	}
+
+	if s.UseJSONMarshaler {
+		if raw, ok := marshalJSON(val, v); ok {
+			return raw
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		n := s.sub(val.Interface())
+
+		// do not add the converted value if there are no exported fields, ie:
+		// time.Time, or if it's a leaf type
+		if len(n.structFields()) == 0 || s.isLeaf(v.Type()) {
+			finalVal = val.Interface()
+		} else if id, seen, ok := s.refID(val); ok && seen {
+			finalVal = map[string]interface{}{"$ref": id}
+		} else if s.walk {
+			if ok {
+				n.VirtualFields = map[string]func(interface{}) interface{}{
+					"$id": func(interface{}) interface{} { return id },
+				}
+			}
+			finalVal = n
+		} else {
+			m := n.Map()
+			if ok {
+				m["$id"] = id
+			}
+			finalVal = m
+		}
+	case reflect.Map:
+		// only iterate over maps whose values may hold structs at any depth,
+		// ie: map[string]StructType, map[string][]StructType,
+		// map[string]map[string]*StructType
+		if v.IsNil() && !s.NilMapAsEmpty {
+			finalVal = val.Interface()
+			break
+		}
+
+		if !hasStruct(v.Type().Elem()) {
+			finalVal = val.Interface()
+			if v.IsNil() {
+				finalVal = reflect.MakeMap(v.Type()).Interface()
+			}
+			break
+		}
+
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = s.null(s.nested(v.MapIndex(k)))
+		}
+		finalVal = m
+	case reflect.Slice, reflect.Array:
+		isNil := v.Kind() == reflect.Slice && v.IsNil()
+		if isNil && !s.NilSliceAsEmpty {
+			finalVal = val.Interface()
+			break
+		}
+
+		if v.Kind() == reflect.Slice && !isNil && v.Len() == 0 && s.EmptySliceAsNull {
+			finalVal = reflect.Zero(v.Type()).Interface()
+			break
+		}
+
+		if !hasStruct(v.Type().Elem()) {
+			finalVal = val.Interface()
+			if isNil {
+				finalVal = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+			}
+			break
+		}
+
+		// empty slices of structs get the same type as non-empty ones
+
+		slices := make([]interface{}, v.Len())
+		for x := 0; x < v.Len(); x++ {
+			slices[x] = s.null(s.nested(v.Index(x)))
+		}
+		finalVal = slices
+
+		if s.TypedSliceMaps {
+			if maps, ok := sliceMaps(slices); ok {
+				finalVal = maps
+			}
+		}
+	default:
+		finalVal = val.Interface()
+	}
+
+	return finalVal
+}
+
+// null returns NullValue if val is nil, or a nil pointer, interface, slice,
+// map, func or channel, and val otherwise.
+func (s *Struct) null(val interface{}) interface{} {
+	if s.NullValue == nil {
+		return val
+	}
+
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return s.NullValue
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return s.NullValue
+		}
+	}
+
+	return val
+}
+
+// normalizeNumbers converts the number val, or the slice or array of
+// numbers val, to int64 or float64.
+func normalizeNumbers(val interface{}) interface{} {
+	v := reflect.ValueOf(val)
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		elem := v.Type().Elem().Kind()
+		if elem == reflect.Uint8 && v.Kind() == reflect.Slice || !isNumber(elem) {
+			return val
+		}
+
+		if elem == reflect.Float32 || elem == reflect.Float64 {
+			floats := make([]float64, v.Len())
+			for i := range floats {
+				floats[i] = v.Index(i).Float()
+			}
+			return floats
+		}
+
+		ints := make([]int64, v.Len())
+		for i := range ints {
+			n, ok := normalizeNumbers(v.Index(i).Interface()).(int64)
+			if !ok {
+				return val
+			}
+			ints[i] = n
+		}
+		return ints
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return val
+		}
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+
+	return val
+}
+
+// joinValues joins the elements of the slice or array of scalars val,
+// formatted with fmt.Sprint, with sep. Nil pointers and slices are joined
+// to an empty string.
+func joinValues(val interface{}, sep string) (string, error) {
+	v := reflect.ValueOf(val)
+	if v.Kind() == reflect.Ptr {
+		v = reflect.Indirect(v)
+		if !v.IsValid() {
+			v = reflect.Zero(reflect.TypeOf(val).Elem())
+		}
+	}
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("%w %s: join requires a slice of scalars", ErrUnsupportedKind, v.Kind())
+	}
+
+	switch k := v.Type().Elem().Kind(); {
+	case k == reflect.String, k == reflect.Bool, isNumber(k), k == reflect.Complex64, k == reflect.Complex128:
+	default:
+		return "", fmt.Errorf("%w %s: join requires a slice of scalars", ErrUnsupportedKind, v.Type())
+	}
+
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+
+	return strings.Join(elems, sep), nil
+}
+
+// round rounds the float, or the float elements of the slice or array,
+// val to the given number of decimals. Other values are returned as is.
+func round(val interface{}, digits int) interface{} {
+	v := reflect.ValueOf(val)
+	p := math.Pow10(digits)
+
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		r := reflect.New(v.Type()).Elem()
+		r.SetFloat(math.Round(v.Float()*p) / p)
+		return r.Interface()
+	case reflect.Slice, reflect.Array:
+		elem := v.Type().Elem().Kind()
+		if elem != reflect.Float32 && elem != reflect.Float64 || v.Kind() == reflect.Slice && v.IsNil() {
+			return val
+		}
+
+		// the rounded values keep the type of val, ie: type Prices []float64
+		var r reflect.Value
+		if v.Kind() == reflect.Slice {
+			r = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		} else {
+			r = reflect.New(v.Type()).Elem()
+		}
+		for i := 0; i < v.Len(); i++ {
+			r.Index(i).SetFloat(math.Round(v.Index(i).Float()*p) / p)
+		}
+		return r.Interface()
+	}
+
+	return val
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// errorString returns the message of the error v, or nil if v is nil.
+func errorString(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() || isTypedNil(v) {
+			return nil
+		}
+	}
+
+	return v.Interface().(error).Error()
+}
+
+// sliceMaps returns the values as a []map[string]interface{} if all of them
+// are maps.
+func sliceMaps(values []interface{}) ([]map[string]interface{}, bool) {
+	maps := make([]map[string]interface{}, len(values))
+	for i, val := range values {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		maps[i] = m
+	}
+
+	return maps, true
+}
+
+// label returns the label of the value v of the field with the given tag
+// name from Labels.
+func (s *Struct) label(name string, v reflect.Value) (string, bool) {
+	labels, ok := s.Labels[name]
+	// values which can't be map keys, ie: slices, have no label
+	if !ok || !v.Type().Comparable() {
+		return "", false
+	}
+
+	keys := []interface{}{v.Interface()}
+	switch {
+	case isInt(v.Kind()):
+		keys = append(keys, int(v.Int()))
+	case isUint(v.Kind()):
+		keys = append(keys, uint(v.Uint()))
+	case v.Kind() == reflect.String:
+		keys = append(keys, v.String())
+	}
+
+	for _, key := range keys {
+		if label, ok := labels[key]; ok {
+			return label, true
+		}
+	}
+
+	return "", false
+}
+
+// skipKind reports whether fields of kind k are skipped with SkipKinds.
+func (s *Struct) skipKind(k reflect.Kind) bool {
+	for _, skip := range s.SkipKinds {
+		if k == skip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// length returns the length of v if it's a slice, array, map or string, or
+// a pointer to or an interface holding one. Nil values, including nil
+// interfaces, have a length of 0.
+func length(v reflect.Value) (int, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if !v.IsNil() {
+			v = v.Elem()
+			continue
+		}
+
+		// the dynamic type of a nil interface is unknown
+		if v.Kind() == reflect.Interface {
+			return 0, true
+		}
+
+		v = reflect.Zero(v.Type().Elem())
+		if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			return 0, true
+		}
+		break
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		return v.Len(), true
+	}
+
+	return 0, false
+}
+
+// isLeaf reports whether t is one of the LeafTypes.
+func (s *Struct) isLeaf(t reflect.Type) bool {
+	for _, leaf := range s.LeafTypes {
+		if t == leaf {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sqlNull unwraps the database/sql Null types, ie: sql.NullString. It
+// returns the inner value if it's valid, nil if it's not and false if v is
+// not one of the Null types.
+func sqlNull(v reflect.Value) (interface{}, bool) {
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	t := v.Type()
+	if t.PkgPath() != "database/sql" || !strings.HasPrefix(t.Name(), "Null") {
+		return nil, false
+	}
+
+	valid := v.FieldByName("Valid")
+	if valid.Kind() != reflect.Bool {
+		return nil, false
+	}
+
+	if !valid.Bool() {
+		return nil, true
+	}
+
+	return v.Field(0).Interface(), true
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeValue converts v to TimeLocation and formats it with TimeFormat, if
+// it's a time.Time value and either is set.
+func (s *Struct) timeValue(v reflect.Value) (interface{}, bool) {
+	if s.TimeLocation == nil && s.TimeFormat == "" || !v.IsValid() || v.Type() != timeType {
+		return nil, false
+	}
+
+	t := v.Interface().(time.Time)
+	if s.TimeLocation != nil {
+		t = t.In(s.TimeLocation)
+	}
+
+	if s.TimeFormat != "" {
+		return t.Format(s.TimeFormat), true
+	}
+
+	return t, true
+}
+
+// compact removes nil values, empty strings and empty slices and maps from
+// m, recursing into nested maps and slices, including the maps inside of
+// slices.
+func compact(m map[string]interface{}) {
+	for k, val := range m {
+		if c, empty := compactValue(val); empty {
+			delete(m, k)
+		} else {
+			m[k] = c
+		}
+	}
+}
+
+// compactValue returns val with the maps it holds compacted and the empty
+// elements of its slices removed, and reports whether it's empty
+// afterwards.
+func compactValue(val interface{}) (interface{}, bool) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		compact(v)
+	case []map[string]interface{}:
+		out := v[:0:0]
+		for _, e := range v {
+			if compact(e); len(e) > 0 {
+				out = append(out, e)
+			}
+		}
+		val = out
+	case []interface{}:
+		out := v[:0:0]
+		for _, e := range v {
+			if c, empty := compactValue(e); !empty {
+				out = append(out, c)
+			}
+		}
+		val = out
+	}
+
+	return val, isEmptyValue(val)
+}
+
+// isEmptyValue reports whether v is nil, an empty string or an empty slice
+// or map.
+func isEmptyValue(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+
+	return false
+}
+
+// marshalJSON returns the JSON encoding of val if it implements
+// json.Marshaler.
+func marshalJSON(val, v reflect.Value) (json.RawMessage, bool) {
+	i, ok := asInterface(val, v, reflect.TypeOf((*json.Marshaler)(nil)).Elem())
+	if !ok {
+		return nil, false
+	}
+
+	b, err := i.(json.Marshaler).MarshalJSON()
+	if err != nil {
+		return nil, false
+	}
+
+	return json.RawMessage(b), true
+}
+
+// marshalText returns the text encoding of val if it implements
+// encoding.TextMarshaler.
+func marshalText(val, v reflect.Value) (string, bool) {
+	i, ok := asInterface(val, v, reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem())
+	if !ok {
+		return "", false
+	}
+
+	b, err := i.(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return "", false
+	}
+
+	return string(b), true
+}
+
+// asInterface returns val as the interface type iface if it, or a pointer
+// to val or to its dereferenced value v, implements iface. time.Time values
+// are never returned, as they are handled by the package itself.
+func asInterface(val, v reflect.Value, iface reflect.Type) (interface{}, bool) {
+	if !v.IsValid() || v.Type() == reflect.TypeOf(time.Time{}) {
+		return nil, false
+	}
+
+	if reflect.TypeOf(val.Interface()).Implements(iface) {
+		return val.Interface(), true
+	}
+
+	if val.CanAddr() && val.Addr().Type().Implements(iface) {
+		return val.Addr().Interface(), true
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(iface) {
+		return v.Addr().Interface(), true
+	}
+
+	return nil, false
+}
+
+// isStructType reports whether t is a struct or a pointer to a struct type.
+func isStructType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// isZeroPointer reports whether v is a non-nil pointer to a zero value,
+// dereferencing pointers to pointers.
+func isZeroPointer(v reflect.Value) bool {
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	return v.IsZero()
+}
+
+// isZeroStruct reports whether the struct, or pointer to struct, v is nil or
+// zero.
+func isZeroStruct(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return v.IsZero()
+}
+
+// isTypedNil reports whether v is an interface holding a nil pointer, map,
+// slice, channel or func, ie: an io.Writer holding a nil *bytes.Buffer.
+func isTypedNil(v reflect.Value) bool {
+	if v.Kind() != reflect.Interface || v.IsNil() {
+		return false
+	}
+
+	switch e := v.Elem(); e.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return e.IsNil()
+	}
+
+	return false
+}
+
+// unsupportedKind returns the kind of v, or of the value held by v if it's
+// an interface, if it's a func, channel or unsafe pointer.
+func unsupportedKind(v reflect.Value) (reflect.Kind, bool) {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Invalid, false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return v.Kind(), true
+	}
+
+	return reflect.Invalid, false
+}
+
+// hasStruct reports whether values of type t are or may contain structs,
+// looking through pointers, slices, arrays and maps. Interfaces may hold
+// structs.
+func hasStruct(t reflect.Type) bool {
+	return hasStructSeen(t, make(map[reflect.Type]bool))
+}
+
+// hasStructSeen is hasStruct, skipping the types already visited, so
+// recursive types, ie: `type L []L`, terminate.
+func hasStructSeen(t reflect.Type, seen map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		return hasStructSeen(t.Elem(), seen)
+	}
+
+	return false
+}
+
+// Has returns true if the given option is available in tagOptions
+func (t tagOptions) Has(opt string) bool {
+	for _, tagOpt := range t {
+		if tagOpt == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get returns the value of the given key=value option and whether the
+// option is available in tagOptions, ie: "section" for "section=basic".
+func (t tagOptions) Get(key string) (string, bool) {
+	for _, tagOpt := range t {
+		if k, v, ok := strings.Cut(tagOpt, "="); ok && k == key {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// parseTag splits a struct field's tag into its name and a list of options
+// which comes after a name. A tag is in the form of: "name,option1,option2".
+// The name can be neglectected.
+func parseTag(tag string) (string, tagOptions) {
+	return parseTagSep(tag, ',')
+}
+
+// parseTagSep is the same as parseTag, but splits the options with the
+// given separator, ie: "name;option1;option2" for ';'.
+func parseTagSep(tag string, sep rune) (string, tagOptions) {
+	if sep == 0 {
+		sep = ','
+	}
+
+	res := strings.Split(tag, string(sep))
+
+	// the separator itself is given as a value by "key=" followed by an
+	// empty option, ie: "join=," for ','
+	opts := res[1:]
+	for i := 0; i+1 < len(opts); i++ {
+		if strings.HasSuffix(opts[i], "=") && opts[i+1] == "" {
+			opts[i] += string(sep)
+			opts = append(opts[:i+1], opts[i+2:]...)
+		}
+	}
+
+	return res[0], opts
+}
+
+// parseTag parses the tag of the given field for the TagName of s, using
+// its TagOptionSeparator.
+func (s *Struct) parseTag(field reflect.StructField) (string, tagOptions) {
+	name, opts := parseTagSep(field.Tag.Get(s.TagName), s.TagOptionSeparator)
+	if !s.goNames {
+		return name, opts
+	}
+
+	if opts.Has("secret") {
+		return "", tagOptions{"secret"}
+	}
+	return "", nil
 }
@@ -1,9 +1,21 @@
 package structs
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode"
 )
 
 func TestMapNonStruct(t *testing.T) {
@@ -141,6 +153,64 @@ func TestMap_CustomTag(t *testing.T) {
 
 }
 
+func TestMap_NestedAnonymousStructTags(t *testing.T) {
+	var T = struct {
+		Name   string `json:"name"`
+		Server struct {
+			Host string `json:"host"`
+			Port int    `json:"port,omitempty"`
+			TLS  *struct {
+				Cert string `json:"cert,omitempty"`
+				Key  string `json:"key;secret"`
+			} `json:"tls"`
+		} `json:"server"`
+		Items []struct {
+			ID   int    `json:"id"`
+			Note string `json:"note,omitempty"`
+		} `json:"items"`
+	}{Name: "example"}
+
+	T.Server.Host = "localhost"
+	T.Server.TLS = &struct {
+		Cert string `json:"cert,omitempty"`
+		Key  string `json:"key;secret"`
+	}{Key: "key"}
+	T.Items = append(T.Items, struct {
+		ID   int    `json:"id"`
+		Note string `json:"note,omitempty"`
+	}{ID: 1})
+
+	s := New(T)
+	s.TagName = "json"
+
+	expected := map[string]interface{}{
+		"name": "example",
+		"server": map[string]interface{}{
+			"host": "localhost",
+			"tls":  map[string]interface{}{"key;secret": "key"},
+		},
+		"items": []interface{}{map[string]interface{}{"id": 1}},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should honor the tags of nested anonymous structs, expected %v, got: %v", expected, m)
+	}
+
+	s.TagOptionSeparator = ';'
+
+	expected["server"].(map[string]interface{})["port,omitempty"] = 0
+	expected["server"].(map[string]interface{})["tls"] = map[string]interface{}{"cert,omitempty": "", "key": "key"}
+	expected["items"] = []interface{}{map[string]interface{}{"id": 1, "note,omitempty": ""}}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should parse the tags of nested anonymous structs with TagOptionSeparator, expected %v, got: %v", expected, m)
+	}
+
+	if m := s.MapRedacted(); m["server"].(map[string]interface{})["tls"].(map[string]interface{})["key"] != DefaultRedactWith {
+		t.Errorf("MapRedacted should honor the options of nested anonymous structs, got: %v", m)
+	}
+}
+
 func TestMap_OmitEmpty(t *testing.T) {
 	type A struct {
 		Name  string
@@ -162,6 +232,26 @@ func TestMap_OmitEmpty(t *testing.T) {
 	}
 }
 
+func TestMap_KeepEmpty(t *testing.T) {
+	type A struct {
+		Name  string `structs:"name"`
+		Count int    `structs:"count,keepempty"`
+		Total int    `structs:"total,omitempty,keepempty"`
+	}
+
+	s := New(A{})
+	s.OmitEmpty = true
+
+	expected := map[string]interface{}{"count": 0, "total": 0}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should keep the fields tagged with keepempty, expected %v, got: %v", expected, m)
+	}
+
+	if values := s.Values(); len(values) != 2 {
+		t.Errorf("Values should keep the fields tagged with keepempty, got: %v", values)
+	}
+}
+
 func TestMap_OmitNested(t *testing.T) {
 	type A struct {
 		Name  string
@@ -357,6 +447,67 @@ func TestMap_NestedSliceWithIntValues(t *testing.T) {
 	}
 }
 
+func TestMap_NestedSliceWithScalarValues(t *testing.T) {
+	type tags []string
+
+	type person struct {
+		Names  []string  `structs:"names"`
+		Scores []float64 `structs:"scores"`
+		Flags  []bool    `structs:"flags"`
+		Tags   tags      `structs:"tags"`
+	}
+
+	p := person{
+		Names:  []string{"a", "b"},
+		Scores: []float64{1.5},
+		Flags:  []bool{true, false},
+		Tags:   tags{"x"},
+	}
+	m := Map(p)
+
+	if names, ok := m["names"].([]string); !ok || !reflect.DeepEqual(names, p.Names) {
+		t.Errorf("Nested type of map should be []string %v, have %T %v", p.Names, m["names"], m["names"])
+	}
+
+	if scores, ok := m["scores"].([]float64); !ok || !reflect.DeepEqual(scores, p.Scores) {
+		t.Errorf("Nested type of map should be []float64 %v, have %T %v", p.Scores, m["scores"], m["scores"])
+	}
+
+	if flags, ok := m["flags"].([]bool); !ok || !reflect.DeepEqual(flags, p.Flags) {
+		t.Errorf("Nested type of map should be []bool %v, have %T %v", p.Flags, m["flags"], m["flags"])
+	}
+
+	if tags, ok := m["tags"].(tags); !ok || !reflect.DeepEqual(tags, p.Tags) {
+		t.Errorf("Nested type of map should be tags %v, have %T %v", p.Tags, m["tags"], m["tags"])
+	}
+}
+
+type recursiveSlice []recursiveSlice
+
+type recursiveMap map[string]recursiveMap
+
+func TestMap_RecursiveTypes(t *testing.T) {
+	type A struct {
+		L recursiveSlice
+		M recursiveMap
+	}
+
+	a := A{
+		L: recursiveSlice{nil, recursiveSlice{nil}},
+		M: recursiveMap{"a": recursiveMap{"b": nil}},
+	}
+
+	m := Map(a)
+
+	if l, ok := m["L"].(recursiveSlice); !ok || !reflect.DeepEqual(l, a.L) {
+		t.Errorf("Map should emit recursive slice types as is, got: %T %v", m["L"], m["L"])
+	}
+
+	if rm, ok := m["M"].(recursiveMap); !ok || !reflect.DeepEqual(rm, a.M) {
+		t.Errorf("Map should emit recursive map types as is, got: %T %v", m["M"], m["M"])
+	}
+}
+
 func TestMap_Flatnested(t *testing.T) {
 	type A struct {
 		Name string
@@ -440,3 +591,2645 @@ func TestParseTag_Opts(t *testing.T) {
 		}
 	}
 }
+
+func TestHas(t *testing.T) {
+	type B struct {
+		Zone string
+	}
+
+	type c struct {
+		Region string
+	}
+
+	type A struct {
+		Name  string `structs:"name"`
+		Value int
+		Skip  string `structs:"-"`
+		priv  string
+		B
+		c
+	}
+	s := New(A{priv: "p"})
+
+	// the fields of unexported embedded structs are promoted
+	for _, name := range []string{"Name", "Value", "B", "Region"} {
+		if !s.Has(name) {
+			t.Errorf("Has should return true for field %q", name)
+		}
+		if _, ok := s.FieldOk(name); !ok {
+			t.Errorf("FieldOk should find field %q reported by Has", name)
+		}
+	}
+
+	// skipped fields and the fields of exported embedded structs can't be
+	// retrieved with FieldOk either
+	for _, name := range []string{"name", "priv", "Missing", "Skip", "Zone", "c"} {
+		if s.Has(name) {
+			t.Errorf("Has should return false for field %q", name)
+		}
+	}
+}
+
+func TestHasTag(t *testing.T) {
+	type A struct {
+		Name  string `structs:"name"`
+		Value int
+		Skip  string `structs:"-"`
+	}
+	s := New(A{})
+
+	for _, key := range []string{"name", "Value"} {
+		if !s.HasTag(key) {
+			t.Errorf("HasTag should return true for key %q", key)
+		}
+	}
+
+	for _, key := range []string{"Name", "Skip", "-", "missing"} {
+		if s.HasTag(key) {
+			t.Errorf("HasTag should return false for key %q", key)
+		}
+	}
+}
+
+func TestMap_EnumTables(t *testing.T) {
+	type Status int
+
+	type A struct {
+		Status Status `structs:"status"`
+		Other  Status `structs:"other"`
+		Count  int    `structs:"count"`
+	}
+
+	s := New(A{Status: 2, Other: 7, Count: 2})
+	s.EnumTables = map[string]map[int]string{
+		"status": {1: "pending", 2: "active"},
+		"other":  {1: "pending", 2: "active"},
+	}
+
+	m := s.Map()
+
+	if status, ok := m["status"].(string); !ok || status != "active" {
+		t.Errorf("Map should emit the enum name 'active' for status, got: %#v", m["status"])
+	}
+
+	if other, ok := m["other"].(Status); !ok || other != 7 {
+		t.Errorf("Map should fall back to the raw value for unknown enums, got: %#v", m["other"])
+	}
+
+	if count, ok := m["count"].(int); !ok || count != 2 {
+		t.Errorf("Map should not touch fields without an enum table, got: %#v", m["count"])
+	}
+}
+
+func TestNewFromType(t *testing.T) {
+	type A struct {
+		Name string
+		Port int
+	}
+
+	s, err := NewFromType(reflect.TypeOf(A{}))
+	if err != nil {
+		t.Fatalf("NewFromType should not return an error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(s.Map(), map[string]interface{}{"Name": "", "Port": 0}) {
+		t.Errorf("NewFromType should wrap a zero value, got: %v", s.Map())
+	}
+
+	s.value.FieldByName("Name").SetString("example")
+	s.value.FieldByName("Port").SetInt(80)
+
+	a, ok := s.Interface().(*A)
+	if !ok {
+		t.Fatalf("Interface should return a *A, got: %T", s.Interface())
+	}
+
+	if a.Name != "example" || a.Port != 80 {
+		t.Errorf("NewFromType should return a settable struct, got: %+v", a)
+	}
+}
+
+func TestNewFromType_NonStruct(t *testing.T) {
+	for _, typ := range []reflect.Type{nil, reflect.TypeOf(1), reflect.TypeOf([]string{})} {
+		if _, err := NewFromType(typ); !errors.Is(err, ErrNotStruct) {
+			t.Errorf("NewFromType(%v) should return ErrNotStruct, got: %v", typ, err)
+		}
+	}
+}
+
+func TestNewPointer(t *testing.T) {
+	type A struct {
+		Name string
+	}
+
+	var a A
+	s, err := NewPointer(&a)
+	if err != nil {
+		t.Fatalf("NewPointer should not return an error, got: %s", err)
+	}
+
+	if err := s.SetPath("Name", "example"); err != nil || a.Name != "example" {
+		t.Errorf("NewPointer should return a settable struct, got: %+v, %v", a, err)
+	}
+
+	var nilPtr *A
+	for _, v := range []interface{}{a, nilPtr, nil} {
+		if _, err := NewPointer(v); !errors.Is(err, ErrNotSettable) {
+			t.Errorf("NewPointer(%#v) should return ErrNotSettable, got: %v", v, err)
+		}
+	}
+
+	n := 1
+	if _, err := NewPointer(&n); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("NewPointer should return ErrNotStruct for a pointer to a non struct, got: %v", err)
+	}
+}
+
+func TestMap_Base64(t *testing.T) {
+	type A struct {
+		Data []byte `structs:"data,base64"`
+		Raw  []byte `structs:"raw"`
+	}
+
+	a := A{Data: []byte("hello"), Raw: []byte("world")}
+	m := Map(a)
+
+	data, ok := m["data"].(string)
+	if !ok {
+		t.Fatalf("Map should emit base64 fields as string, got: %T", m["data"])
+	}
+
+	if data != "aGVsbG8=" {
+		t.Errorf("Map should emit the base64 encoding 'aGVsbG8=', got: %s", data)
+	}
+
+	raw, ok := m["raw"].([]byte)
+	if !ok {
+		t.Fatalf("Map should emit other byte fields as []byte, got: %T", m["raw"])
+	}
+
+	if string(raw) != "world" {
+		t.Errorf("Map should emit the raw bytes 'world', got: %s", raw)
+	}
+}
+
+func TestMap_NestedMapOfMapsWithStructValues(t *testing.T) {
+	type A struct {
+		Name string
+	}
+
+	type B struct {
+		A map[string]map[string]*A
+		C map[string][]map[string]A
+	}
+
+	b := &B{
+		A: map[string]map[string]*A{
+			"outer": {"inner": {Name: "example"}},
+		},
+		C: map[string][]map[string]A{
+			"list": {{"item": {Name: "deep"}}},
+		},
+	}
+
+	m := Map(b)
+
+	outer, ok := m["A"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Nested type of map should be of type map[string]interface{}, have %T", m["A"])
+	}
+
+	inner, ok := outer["outer"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Nested map value should be of type map[string]interface{}, have %T", outer["outer"])
+	}
+
+	a, ok := inner["inner"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Nested struct value should be of type map[string]interface{}, have %T", inner["inner"])
+	}
+
+	if name := a["Name"].(string); name != "example" {
+		t.Errorf("Map nested struct's name field should give example, got: %s", name)
+	}
+
+	expected := map[string]interface{}{
+		"list": []interface{}{
+			map[string]interface{}{
+				"item": map[string]interface{}{"Name": "deep"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(m["C"], expected) {
+		t.Errorf("Map should recurse into slices of maps, expected %v, got: %v", expected, m["C"])
+	}
+}
+
+type embeddedInner struct {
+	Name string
+	Port int
+	priv string
+}
+
+func TestMap_UnexportedEmbedded(t *testing.T) {
+	type A struct {
+		ID int
+		embeddedInner
+		Port string
+	}
+
+	a := A{ID: 1, Port: "http"}
+	a.Name = "example"
+	a.embeddedInner.Port = 80
+
+	m := Map(a)
+
+	expected := map[string]interface{}{"ID": 1, "Name": "example", "Port": "http"}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should promote fields of unexported embedded structs, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_UnexportedEmbeddedOmitted(t *testing.T) {
+	type A struct {
+		ID            int
+		embeddedInner `structs:"-"`
+	}
+
+	m := Map(A{ID: 1})
+
+	expected := map[string]interface{}{"ID": 1}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should omit unexported embedded structs tagged with '-', expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_SQLNull(t *testing.T) {
+	type A struct {
+		Name    sql.NullString `structs:"name"`
+		Missing sql.NullString `structs:"missing"`
+		Omitted sql.NullString `structs:"omitted,omitempty"`
+		Count   sql.NullInt64  `structs:"count"`
+		Ptr     *sql.NullBool  `structs:"ptr"`
+		List    []sql.NullString
+	}
+
+	a := A{
+		Name:    sql.NullString{String: "example", Valid: true},
+		Missing: sql.NullString{String: "stale", Valid: false},
+		Omitted: sql.NullString{String: "stale", Valid: false},
+		Count:   sql.NullInt64{Int64: 42, Valid: true},
+		Ptr:     &sql.NullBool{Bool: true, Valid: true},
+		List:    []sql.NullString{{String: "a", Valid: true}, {}},
+	}
+
+	m := Map(a)
+
+	expected := map[string]interface{}{
+		"name":    "example",
+		"missing": nil,
+		"count":   int64(42),
+		"ptr":     true,
+		"List":    []interface{}{"a", nil},
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should unwrap sql.Null types, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestRename(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		Name  string `structs:"name"`
+		Value int
+		B     B
+	}
+
+	s := New(A{Name: "example", Value: 2, B: B{Name: "inner"}})
+
+	if err := s.Rename("Name", "title"); err != nil {
+		t.Fatalf("Rename should not return an error, got: %s", err)
+	}
+
+	if err := s.Rename("Value", "count"); err != nil {
+		t.Fatalf("Rename should not return an error, got: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"title": "example",
+		"count": 2,
+		"B":     map[string]interface{}{"Name": "inner"},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should use the renamed keys, expected %v, got: %v", expected, m)
+	}
+
+	if !s.HasTag("title") || s.HasTag("name") {
+		t.Error("HasTag should use the renamed keys")
+	}
+}
+
+func TestRename_NotFound(t *testing.T) {
+	type A struct {
+		Name string
+		priv string
+	}
+
+	s := New(A{})
+
+	for _, name := range []string{"Missing", "priv"} {
+		if err := s.Rename(name, "key"); !errors.Is(err, ErrFieldNotFound) {
+			t.Errorf("Rename(%q) should return ErrFieldNotFound, got: %v", name, err)
+		}
+	}
+}
+
+func TestTagCrosswalk(t *testing.T) {
+	type A struct {
+		ID        int    `db:"user_id" json:"id"`
+		Name      string `db:"full_name,omitempty" json:"name,omitempty"`
+		CreatedAt string `db:"created_at"`
+		Internal  string `db:"internal" json:"-"`
+		Password  string `db:"-" json:"password"`
+	}
+
+	s := New(A{})
+	s.Rename("ID", "key")
+
+	expected := map[string]string{
+		"user_id":    "id",
+		"full_name":  "name",
+		"created_at": "CreatedAt",
+	}
+
+	if m := s.TagCrosswalk("db", "json"); !reflect.DeepEqual(m, expected) {
+		t.Errorf("TagCrosswalk should return %v, got: %v", expected, m)
+	}
+}
+
+func TestMapRedacted(t *testing.T) {
+	type credentials struct {
+		User  string `structs:"user"`
+		Token string `structs:"token,secret"`
+	}
+
+	type A struct {
+		Name        string      `structs:"name"`
+		Password    string      `structs:"password,secret"`
+		Empty       string      `structs:"empty,secret,omitempty"`
+		Credentials credentials `structs:"credentials"`
+	}
+
+	a := A{
+		Name:        "example",
+		Password:    "hunter2",
+		Credentials: credentials{User: "admin", Token: "t0ken"},
+	}
+
+	expected := map[string]interface{}{
+		"name":     "example",
+		"password": "***",
+		"credentials": map[string]interface{}{
+			"user":  "admin",
+			"token": "***",
+		},
+	}
+
+	s := New(a)
+	if m := s.MapRedacted(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapRedacted should mask secret fields, expected %v, got: %v", expected, m)
+	}
+
+	if m := s.Map(); m["password"] != "hunter2" {
+		t.Errorf("Map should not mask secret fields, got: %v", m["password"])
+	}
+
+	s.RedactWith = "[redacted]"
+	if m := s.MapRedacted(); m["password"] != "[redacted]" {
+		t.Errorf("MapRedacted should use RedactWith, got: %v", m["password"])
+	}
+}
+
+func TestMap_TimeLocation(t *testing.T) {
+	type A struct {
+		CreatedAt time.Time
+		UpdatedAt *time.Time
+		DeletedAt time.Time `structs:",omitnested"`
+		History   []time.Time
+	}
+
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	created := time.Date(2020, 1, 1, 12, 0, 0, 0, loc)
+
+	a := A{
+		CreatedAt: created,
+		UpdatedAt: &created,
+		DeletedAt: created,
+		History:   []time.Time{created},
+	}
+
+	s := New(a)
+	s.TimeLocation = time.UTC
+
+	m := s.Map()
+
+	for _, key := range []string{"CreatedAt", "UpdatedAt", "DeletedAt"} {
+		ts, ok := m[key].(time.Time)
+		if !ok {
+			t.Fatalf("Map should emit %s as time.Time, got: %T", key, m[key])
+		}
+
+		if ts.Location() != time.UTC || ts.Hour() != 9 || !ts.Equal(created) {
+			t.Errorf("Map should convert %s to UTC, got: %s", key, ts)
+		}
+	}
+
+	history := m["History"].([]interface{})
+	if ts := history[0].(time.Time); ts.Location() != time.UTC {
+		t.Errorf("Map should convert times in slices to UTC, got: %s", ts)
+	}
+
+	if ts := Map(a)["CreatedAt"].(time.Time); ts.Location() != loc {
+		t.Errorf("Map should keep the time's location by default, got: %s", ts)
+	}
+}
+
+func TestValues(t *testing.T) {
+	type B struct {
+		C string
+		D int
+	}
+
+	type A struct {
+		Name    string
+		Empty   string `structs:",omitempty"`
+		Skip    string `structs:"-"`
+		B       B
+		Created time.Time
+		Other   B `structs:",omitnested"`
+	}
+
+	created := time.Now()
+	a := A{Name: "a", Skip: "skip", B: B{C: "c", D: 1}, Created: created, Other: B{C: "x"}}
+
+	expected := []interface{}{"a", "c", 1, created, B{C: "x"}}
+	if values := Values(a); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values should return %v, got: %v", expected, values)
+	}
+}
+
+func TestValues_OrderIndependentOfTags(t *testing.T) {
+	type Untagged struct {
+		A string
+		B int
+		C bool
+		D float64
+	}
+
+	type Tagged struct {
+		A string  `structs:"zzz"`
+		B int     `structs:"aaa"`
+		C bool    `structs:"mmm"`
+		D float64 `structs:"bbb"`
+	}
+
+	untagged := Values(Untagged{A: "a", B: 1, C: true, D: 1.5})
+	tagged := Values(Tagged{A: "a", B: 1, C: true, D: 1.5})
+
+	expected := []interface{}{"a", 1, true, 1.5}
+
+	if !reflect.DeepEqual(untagged, expected) {
+		t.Errorf("Values should return %v, got: %v", expected, untagged)
+	}
+
+	if !reflect.DeepEqual(tagged, untagged) {
+		t.Errorf("Values should not depend on tag names, got: %v and %v", tagged, untagged)
+	}
+}
+
+func TestOrderedValues(t *testing.T) {
+	type B struct {
+		X string `structs:"x,order=2"`
+		Y string `structs:"y,order=1"`
+	}
+
+	type A struct {
+		Name  string `structs:"name,order=3"`
+		ID    int    `structs:"id,order=1"`
+		Notes string `structs:"notes"`
+		B     B      `structs:"b,order=2"`
+		Email string `structs:"email,order=3"`
+		Empty string `structs:"empty,omitempty,order=0"`
+	}
+
+	a := A{Name: "example", ID: 7, Notes: "notes", B: B{X: "x", Y: "y"}, Email: "a@example.com"}
+
+	expected := []interface{}{7, "y", "x", "example", "a@example.com", "notes"}
+	if values := New(a).OrderedValues(); !reflect.DeepEqual(values, expected) {
+		t.Errorf("OrderedValues should return %v, got: %v", expected, values)
+	}
+
+	expected = []interface{}{"example", 7, "notes", "x", "y", "a@example.com"}
+	if values := Values(a); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Values should keep the declaration order, expected %v, got: %v", expected, values)
+	}
+}
+
+func TestMap_Compact(t *testing.T) {
+	type C struct {
+		Empty string
+		Nil   *int
+	}
+
+	type B struct {
+		Name  string
+		Tags  []string
+		Attrs map[string]string
+		C     C
+		Items []C
+	}
+
+	type A struct {
+		Name  string
+		Count int
+		Desc  string
+		Ptr   *B
+		B     B
+	}
+
+	a := A{
+		Name: "example",
+		B: B{
+			Name:  "inner",
+			Tags:  []string{},
+			Items: []C{{}},
+		},
+	}
+
+	s := New(a)
+	s.Compact = true
+
+	expected := map[string]interface{}{
+		"Name":  "example",
+		"Count": 0,
+		"B": map[string]interface{}{
+			"Name": "inner",
+		},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should drop all empty values, expected %v, got: %v", expected, m)
+	}
+
+	type D struct {
+		Items []C
+		List  []interface{}
+	}
+
+	s = New(D{Items: []C{{}, {Empty: "set"}}, List: []interface{}{nil, "", "kept", C{}}})
+	s.Compact = true
+
+	expected = map[string]interface{}{
+		"Items": []interface{}{map[string]interface{}{"Empty": "set"}},
+		"List":  []interface{}{"kept"},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should drop the empty elements of slices, expected %v, got: %v", expected, m)
+	}
+
+	if kvs := s.OrderedMap(); len(kvs) != 2 || !reflect.DeepEqual(kvs[1].Value, expected["List"]) {
+		t.Errorf("OrderedMap should drop the empty elements of slices, got: %v", kvs)
+	}
+}
+
+func TestMap_NestedMapWithInterfaceValues(t *testing.T) {
+	type A struct {
+		Name string `structs:"name"`
+	}
+
+	type B struct {
+		Values map[string]interface{}
+		List   []interface{}
+	}
+
+	b := B{
+		Values: map[string]interface{}{
+			"struct":  A{Name: "a"},
+			"pointer": &A{Name: "b"},
+			"int":     1,
+			"nil":     nil,
+			"ints":    []int{1, 2},
+		},
+		List: []interface{}{A{Name: "c"}, "d"},
+	}
+
+	m := Map(b)
+
+	expected := map[string]interface{}{
+		"Values": map[string]interface{}{
+			"struct":  map[string]interface{}{"name": "a"},
+			"pointer": map[string]interface{}{"name": "b"},
+			"int":     1,
+			"nil":     nil,
+			"ints":    []int{1, 2},
+		},
+		"List": []interface{}{map[string]interface{}{"name": "c"}, "d"},
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should convert structs held in interface values, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_NilSlicesAndMaps(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		Ints    []int
+		Structs []B
+		Attrs   map[string]string
+		Nested  map[string]B
+	}
+
+	m := Map(A{})
+
+	if v, ok := m["Ints"].([]int); !ok || v != nil {
+		t.Errorf("Map should emit a nil []int by default, got: %#v", m["Ints"])
+	}
+
+	if v, ok := m["Structs"].([]B); !ok || v != nil {
+		t.Errorf("Map should emit a nil []B by default, got: %#v", m["Structs"])
+	}
+
+	if v, ok := m["Attrs"].(map[string]string); !ok || v != nil {
+		t.Errorf("Map should emit a nil map[string]string by default, got: %#v", m["Attrs"])
+	}
+
+	if v, ok := m["Nested"].(map[string]B); !ok || v != nil {
+		t.Errorf("Map should emit a nil map[string]B by default, got: %#v", m["Nested"])
+	}
+}
+
+func TestMap_NilSlicesAndMapsAsEmpty(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		Ints    []int
+		Structs []B
+		Attrs   map[string]string
+		Nested  map[string]B
+	}
+
+	s := New(A{})
+	s.NilSliceAsEmpty = true
+	s.NilMapAsEmpty = true
+
+	m := s.Map()
+
+	if v, ok := m["Ints"].([]int); !ok || v == nil || len(v) != 0 {
+		t.Errorf("Map should emit an empty []int, got: %#v", m["Ints"])
+	}
+
+	if v, ok := m["Structs"].([]interface{}); !ok || v == nil || len(v) != 0 {
+		t.Errorf("Map should emit an empty []interface{}, got: %#v", m["Structs"])
+	}
+
+	if v, ok := m["Attrs"].(map[string]string); !ok || v == nil || len(v) != 0 {
+		t.Errorf("Map should emit an empty map[string]string, got: %#v", m["Attrs"])
+	}
+
+	if v, ok := m["Nested"].(map[string]interface{}); !ok || v == nil || len(v) != 0 {
+		t.Errorf("Map should emit an empty map[string]interface{}, got: %#v", m["Nested"])
+	}
+}
+
+type celsius float64
+
+func (c celsius) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%.1fC"`, float64(c))), nil
+}
+
+type point struct {
+	X, Y int
+}
+
+func (p *point) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("[%d,%d]", p.X, p.Y)), nil
+}
+
+func TestMap_UseJSONMarshaler(t *testing.T) {
+	type A struct {
+		Temp    celsius
+		Point   point
+		Ptr     *point
+		Created time.Time
+		Name    string
+	}
+
+	created := time.Now()
+	a := &A{Temp: 21.5, Point: point{1, 2}, Ptr: &point{3, 4}, Created: created, Name: "example"}
+
+	s := New(a)
+	s.UseJSONMarshaler = true
+
+	m := s.Map()
+
+	expected := map[string]interface{}{
+		"Temp":    json.RawMessage(`"21.5C"`),
+		"Point":   json.RawMessage(`[1,2]`),
+		"Ptr":     json.RawMessage(`[3,4]`),
+		"Created": created,
+		"Name":    "example",
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should use MarshalJSON, expected %v, got: %v", expected, m)
+	}
+
+	if p, ok := Map(a)["Point"].(map[string]interface{}); !ok || p["X"] != 1 {
+		t.Errorf("Map should not use MarshalJSON by default, got: %#v", Map(a)["Point"])
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	type A struct {
+		Name string `structs:"name"`
+	}
+
+	m, err := MapValues(map[string]*A{
+		"a":   {Name: "a"},
+		"b":   {Name: "b"},
+		"nil": nil,
+	})
+	if err != nil {
+		t.Fatalf("MapValues should not return an error, got: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"a":   map[string]interface{}{"name": "a"},
+		"b":   map[string]interface{}{"name": "b"},
+		"nil": nil,
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapValues should return %v, got: %v", expected, m)
+	}
+
+	m, err = MapValues(map[int]A{1: {Name: "one"}})
+	if err != nil {
+		t.Fatalf("MapValues should not return an error, got: %s", err)
+	}
+
+	expected = map[string]interface{}{"1": map[string]interface{}{"name": "one"}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapValues should stringify keys, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMapValues_Errors(t *testing.T) {
+	if _, err := MapValues([]string{"a"}); err == nil {
+		t.Error("MapValues should return an error for a non map")
+	}
+
+	if _, err := MapValues(map[string]int{"a": 1}); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("MapValues should return ErrNotStruct for non struct values, got: %v", err)
+	}
+}
+
+type version struct {
+	Major, Minor int
+}
+
+func (v *version) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("v%d.%d", v.Major, v.Minor)), nil
+}
+
+func TestMap_UseTextMarshaler(t *testing.T) {
+	type A struct {
+		IP      net.IP
+		Version version
+		Any     interface{}
+		Created time.Time
+		Port    int
+	}
+
+	created := time.Now()
+	a := &A{
+		IP:      net.ParseIP("192.168.0.1"),
+		Version: version{1, 2},
+		Any:     net.ParseIP("10.0.0.1"),
+		Created: created,
+		Port:    80,
+	}
+
+	s := New(a)
+	s.UseTextMarshaler = true
+
+	m := s.Map()
+
+	expected := map[string]interface{}{
+		"IP":      "192.168.0.1",
+		"Version": "v1.2",
+		"Any":     "10.0.0.1",
+		"Created": created,
+		"Port":    80,
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should use MarshalText, expected %v, got: %v", expected, m)
+	}
+
+	if _, ok := Map(a)["IP"].(net.IP); !ok {
+		t.Errorf("Map should not use MarshalText by default, got: %T", Map(a)["IP"])
+	}
+}
+
+func TestProject(t *testing.T) {
+	type user struct {
+		ID       int    `structs:"id"`
+		Name     string `structs:"name"`
+		Email    string `structs:"email"`
+		Phone    string `structs:"phone"`
+		Street   string `structs:"street"`
+		City     string `structs:"city"`
+		Country  string `structs:"country"`
+		Zip      string `structs:"zip"`
+		Password string `structs:"password"`
+		Admin    bool   `structs:"admin"`
+	}
+
+	type summary struct {
+		ID    int    `structs:"id"`
+		Name  string `structs:"name"`
+		City  string `structs:"city"`
+		Other string `structs:"other"`
+	}
+
+	u := user{ID: 1, Name: "example", Email: "a@b.c", City: "Istanbul", Password: "secret", Admin: true}
+
+	expected := map[string]interface{}{"id": 1, "name": "example", "city": "Istanbul"}
+
+	m, err := Project(u, summary{})
+	if err != nil {
+		t.Fatalf("Project should not return an error, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Project should return %v, got: %v", expected, m)
+	}
+
+	m, err = Project(&u, (*summary)(nil))
+	if err != nil {
+		t.Fatalf("Project should accept a nil shape pointer, got: %s", err)
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Project should return %v, got: %v", expected, m)
+	}
+}
+
+func TestProject_Errors(t *testing.T) {
+	type A struct{ Name string }
+
+	if _, err := Project(1, A{}); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("Project should return ErrNotStruct for a non struct source, got: %v", err)
+	}
+
+	if _, err := Project(A{}, "shape"); !errors.Is(err, ErrNotStruct) {
+		t.Errorf("Project should return ErrNotStruct for a non struct shape, got: %v", err)
+	}
+}
+
+func TestParseTag_Get(t *testing.T) {
+	tags := []struct {
+		tag   string
+		value string
+		has   bool
+	}{
+		{"name", "", false},
+		{"name,opt", "", false},
+		{"name,opt=", "", true},
+		{"name,opt=value", "value", true},
+		{"name,omitempty,opt=a=b", "a=b", true},
+		{"name,other=value", "", false},
+	}
+
+	for _, tag := range tags {
+		_, opts := parseTag(tag.tag)
+
+		value, has := opts.Get("opt")
+		if value != tag.value || has != tag.has {
+			t.Errorf("Tag opts Get should return %q, %t for %q, got: %q, %t", tag.value, tag.has, tag.tag, value, has)
+		}
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	type B struct {
+		Z string
+		A string
+	}
+
+	type C struct {
+		Street string
+	}
+
+	type D struct {
+		First string
+		B     `structs:",flatten"`
+		C     C
+		Last  string
+		Empty string `structs:",omitempty"`
+	}
+
+	d := D{First: "first", B: B{Z: "z", A: "a"}, C: C{Street: "main"}, Last: "last"}
+
+	expected := []KeyValue{
+		{"First", "first"},
+		{"Z", "z"},
+		{"A", "a"},
+		{"C", map[string]interface{}{"Street": "main"}},
+		{"Last", "last"},
+	}
+
+	for i := 0; i < 10; i++ {
+		if kvs := New(d).OrderedMap(); !reflect.DeepEqual(kvs, expected) {
+			t.Fatalf("OrderedMap should return %v, got: %v", expected, kvs)
+		}
+	}
+}
+
+func TestOrderedMap_Promoted(t *testing.T) {
+	type A struct {
+		ID int
+		embeddedInner
+		Last string
+	}
+
+	a := A{ID: 1, Last: "last"}
+	a.Name = "example"
+	a.Port = 80
+
+	expected := []KeyValue{
+		{"ID", 1},
+		{"Name", "example"},
+		{"Port", 80},
+		{"Last", "last"},
+	}
+
+	if kvs := New(a).OrderedMap(); !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("OrderedMap should return %v, got: %v", expected, kvs)
+	}
+}
+
+func TestOrderedMapFunc(t *testing.T) {
+	type B struct {
+		Zone string
+		Id   int
+	}
+
+	type A struct {
+		Name   string
+		B      `structs:",flatten"`
+		Port   int
+		Active bool
+	}
+
+	a := A{Name: "example", B: B{Zone: "eu", Id: 1}, Port: 80, Active: true}
+
+	expected := []KeyValue{
+		{"Id", 1},
+		{"Name", "example"},
+		{"Port", 80},
+		{"Zone", "eu"},
+		{"Active", true},
+	}
+
+	kvs := New(a).OrderedMapFunc(func(a, b string) bool {
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	if !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("OrderedMapFunc should return %v, got: %v", expected, kvs)
+	}
+
+	// keys which compare equal keep their declaration order
+	kvs = New(a).OrderedMapFunc(func(a, b string) bool { return false })
+	if !reflect.DeepEqual(kvs, New(a).OrderedMap()) {
+		t.Errorf("OrderedMapFunc should keep the declaration order of equal keys, got: %v", kvs)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	type B struct {
+		Zone string
+	}
+
+	type A struct {
+		Name  string
+		B     B
+		Items []B
+	}
+
+	a := A{Name: "example", B: B{Zone: "eu"}, Items: []B{{Zone: "us"}}}
+
+	var keys []string
+	err := New(a).Walk(func(key string, value interface{}) error {
+		keys = append(keys, key)
+
+		switch key {
+		case "B":
+			n, ok := value.(*Struct)
+			if !ok {
+				t.Fatalf("Walk should pass nested structs as *Struct, got: %T", value)
+			}
+			if m := n.Map(); !reflect.DeepEqual(m, map[string]interface{}{"Zone": "eu"}) {
+				t.Errorf("Walk should pass the nested struct, got: %v", m)
+			}
+		case "Items":
+			items, ok := value.([]interface{})
+			if !ok || len(items) != 1 {
+				t.Fatalf("Walk should pass slices of structs as []interface{}, got: %T", value)
+			}
+			if _, ok := items[0].(*Struct); !ok {
+				t.Errorf("Walk should pass structs in slices as *Struct, got: %T", items[0])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk should not return an error, got: %v", err)
+	}
+
+	if expected := []string{"Name", "B", "Items"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Walk should visit the keys %v, got: %v", expected, keys)
+	}
+
+	// the first error stops the walk
+	errStop := errors.New("stop")
+	keys = nil
+	err = New(a).Walk(func(key string, value interface{}) error {
+		keys = append(keys, key)
+		return errStop
+	})
+	if err != errStop || len(keys) != 1 {
+		t.Errorf("Walk should stop at the first error, got: %v after %v", err, keys)
+	}
+}
+
+func TestOrderedMap_DuplicateKeys(t *testing.T) {
+	type B struct {
+		Name string
+		Port int
+	}
+
+	type A struct {
+		Name string
+		B    `structs:",flatten"`
+	}
+
+	a := A{Name: "outer", B: B{Name: "inner", Port: 80}}
+
+	expected := []KeyValue{
+		{"Name", "inner"},
+		{"Port", 80},
+	}
+
+	if kvs := New(a).OrderedMap(); !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("OrderedMap should return %v, got: %v", expected, kvs)
+	}
+
+	if m := Map(a); m["Name"] != "inner" {
+		t.Errorf("Map should keep the last value of a duplicate key, got: %v", m["Name"])
+	}
+}
+
+func TestValueOr(t *testing.T) {
+	type A struct {
+		Host    string `structs:"host"`
+		Port    int    `structs:"port"`
+		Timeout time.Duration
+	}
+
+	s := New(A{Host: "example.com"})
+
+	if v := s.ValueOr("Host", "localhost"); v != "example.com" {
+		t.Errorf("ValueOr should return the field's value, got: %v", v)
+	}
+
+	if v := s.ValueOr("host", "localhost"); v != "example.com" {
+		t.Errorf("ValueOr should find the field by key, got: %v", v)
+	}
+
+	if v := s.ValueOr("Port", 8080); v != 8080 {
+		t.Errorf("ValueOr should return the default for a zero field, got: %v", v)
+	}
+
+	if v := s.ValueOr("Timeout", time.Second); v != time.Second {
+		t.Errorf("ValueOr should return the default for a zero field, got: %v", v)
+	}
+
+	if v := s.ValueOr("Missing", "default"); v != "default" {
+		t.Errorf("ValueOr should return the default for a missing field, got: %v", v)
+	}
+}
+
+func TestMap_ShouldRecurse(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		Public   B
+		Internal *B
+		Count    int
+	}
+
+	a := A{Public: B{Name: "public"}, Internal: &B{Name: "internal"}, Count: 1}
+
+	var called []string
+
+	s := New(a)
+	s.ShouldRecurse = func(f *Field) bool {
+		called = append(called, f.Name())
+		return f.Name() != "Internal"
+	}
+
+	m := s.Map()
+
+	if _, ok := m["Public"].(map[string]interface{}); !ok {
+		t.Errorf("Map should recurse into Public, got: %T", m["Public"])
+	}
+
+	if internal, ok := m["Internal"].(*B); !ok || internal != a.Internal {
+		t.Errorf("Map should not recurse into Internal, got: %T", m["Internal"])
+	}
+
+	if expected := []string{"Public", "Internal"}; !reflect.DeepEqual(called, expected) {
+		t.Errorf("ShouldRecurse should be called for struct fields %v only, got: %v", expected, called)
+	}
+}
+
+func TestMap_JSONOption(t *testing.T) {
+	type meta struct {
+		Source string `structs:"source"`
+		Tags   []string
+	}
+
+	type A struct {
+		Meta    meta  `structs:"meta,json"`
+		Empty   *meta `structs:"empty,json,omitempty"`
+		Raw     meta  `structs:"raw"`
+		Version int   `structs:"version"`
+	}
+
+	a := A{Meta: meta{Source: "api", Tags: []string{"a"}}, Raw: meta{Source: "raw"}, Version: 1}
+
+	m := Map(a)
+
+	data, ok := m["meta"].(string)
+	if !ok {
+		t.Fatalf("Map should emit json fields as string, got: %T", m["meta"])
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatalf("Map should emit valid JSON, got: %s", err)
+	}
+
+	expected := map[string]interface{}{"source": "api", "Tags": []interface{}{"a"}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Map should emit the JSON of the map representation %v, got: %v", expected, decoded)
+	}
+
+	if _, ok := m["empty"]; ok {
+		t.Error("Map should omit empty json fields tagged with omitempty")
+	}
+
+	if _, ok := m["raw"].(map[string]interface{}); !ok {
+		t.Errorf("Map should emit other nested structs as maps, got: %T", m["raw"])
+	}
+}
+
+type getterUser struct {
+	FirstName string `structs:"first_name"`
+	LastName  string `structs:"last_name"`
+	FullName  string `structs:"full_name"`
+	Email     string `structs:"email"`
+}
+
+func (u getterUser) GetFullName() string {
+	return u.FirstName + " " + u.LastName
+}
+
+func (u *getterUser) GetEmail() string {
+	return strings.ToLower(u.Email)
+}
+
+func TestMap_UseGetters(t *testing.T) {
+	u := getterUser{FirstName: "John", LastName: "Doe", Email: "John@Example.com"}
+
+	s := New(&u)
+	s.UseGetters = true
+
+	expected := map[string]interface{}{
+		"first_name": "John",
+		"last_name":  "Doe",
+		"full_name":  "John Doe",
+		"email":      "john@example.com",
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should use the getters, expected %v, got: %v", expected, m)
+	}
+
+	s = New(u)
+	s.UseGetters = true
+
+	if m := s.Map(); m["full_name"] != "John Doe" || m["email"] != "John@Example.com" {
+		t.Errorf("Map should only use value receiver getters for non pointers, got: %v", m)
+	}
+
+	if m := Map(u); m["full_name"] != "" {
+		t.Errorf("Map should not use getters by default, got: %v", m["full_name"])
+	}
+}
+
+func TestMap_OmitEmptyNested(t *testing.T) {
+	type B struct {
+		Name string
+		Tags []string
+	}
+
+	type A struct {
+		Name    string
+		Zero    B
+		ZeroPtr *B
+		Nil     *B
+		Set     B
+		Raw     B `structs:",omitnested"`
+		RawSet  B `structs:",omitnested"`
+		Created time.Time
+	}
+
+	a := A{ZeroPtr: &B{}, Set: B{Name: "set"}, RawSet: B{Name: "raw"}}
+
+	s := New(a)
+	s.OmitEmptyNested = true
+
+	expected := map[string]interface{}{
+		"Name":   "",
+		"Set":    map[string]interface{}{"Name": "set", "Tags": []string(nil)},
+		"RawSet": B{Name: "raw"},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should omit zero nested structs, expected %v, got: %v", expected, m)
+	}
+
+	if m := Map(a); len(m) != 8 {
+		t.Errorf("Map should keep zero nested structs by default, got: %v", m)
+	}
+}
+
+func TestMap_TypedNilInterface(t *testing.T) {
+	type A struct {
+		Writer  io.Writer
+		Omitted io.Writer `structs:",omitempty"`
+		Raw     io.Writer `structs:",omitnested"`
+		Nil     io.Writer
+		Any     interface{}
+	}
+
+	var buf *bytes.Buffer
+	a := A{Writer: buf, Omitted: buf, Raw: buf, Any: buf}
+
+	expected := map[string]interface{}{
+		"Writer": nil,
+		"Raw":    nil,
+		"Nil":    nil,
+		"Any":    nil,
+	}
+
+	m := Map(a)
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit typed nil interfaces as nil, expected %v, got: %#v", expected, m)
+	}
+
+	for k, v := range m {
+		if v != nil {
+			t.Errorf("Map should emit an untyped nil for %s, got: %#v", k, v)
+		}
+	}
+
+	if values := Values(a); len(values) != 4 {
+		t.Errorf("Values should omit typed nil interfaces tagged with omitempty, got: %v", values)
+	}
+}
+
+func TestParseTag_Separator(t *testing.T) {
+	name, opts := parseTagSep("name;default=a,b;opt", ';')
+
+	if name != "name" {
+		t.Errorf("Parse tag should return name, got: %s", name)
+	}
+
+	if !opts.Has("opt") {
+		t.Errorf("Tag opts should have opt: %#v", opts)
+	}
+
+	if def, _ := opts.Get("default"); def != "a,b" {
+		t.Errorf("Tag opts should have default a,b, got: %s", def)
+	}
+}
+
+func TestMap_TagOptionSeparator(t *testing.T) {
+	type A struct {
+		Name  string `structs:"name;omitempty"`
+		Value string `structs:"value;omitempty;section=a,b"`
+		Count int    `structs:"count,omitempty"`
+	}
+
+	s := New(A{Value: "v"})
+	s.TagOptionSeparator = ';'
+
+	expected := map[string]interface{}{"value": "v", "count,omitempty": 0}
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should use the tag option separator, expected %v, got: %v", expected, m)
+	}
+
+	groups := s.GroupByOption("section")
+	if fields := groups["a,b"]; len(fields) != 1 || fields[0].Name() != "Value" {
+		t.Errorf("GroupByOption should use the tag option separator, got: %v", groups)
+	}
+}
+
+func TestMap_OmitEmptyDereferences(t *testing.T) {
+	type A struct {
+		Zero  *int `structs:"zero,omitempty"`
+		Set   *int `structs:"set,omitempty"`
+		Nil   *int `structs:"nil,omitempty"`
+		Plain *int `structs:"plain"`
+	}
+
+	zero, one := 0, 1
+	a := A{Zero: &zero, Set: &one, Plain: &zero}
+
+	m := Map(a)
+	if _, ok := m["zero"]; !ok {
+		t.Error("Map should keep pointers to zero values by default")
+	}
+
+	s := New(a)
+	s.OmitEmptyDereferences = true
+
+	m = s.Map()
+	if _, ok := m["zero"]; ok {
+		t.Error("Map should omit pointers to zero values with OmitEmptyDereferences")
+	}
+
+	for _, key := range []string{"set", "plain"} {
+		if _, ok := m[key]; !ok {
+			t.Errorf("Map should keep %s with OmitEmptyDereferences", key)
+		}
+	}
+
+	if _, ok := m["nil"]; ok {
+		t.Error("Map should omit nil pointers")
+	}
+}
+
+func TestGoNameMap(t *testing.T) {
+	type B struct {
+		City string `structs:"city"`
+	}
+
+	type A struct {
+		Name     string `structs:"name"`
+		Empty    string `structs:"empty,omitempty"`
+		Password string `structs:"-"`
+		Token    string `structs:"token,secret"`
+		Address  B      `structs:"address"`
+	}
+
+	s := New(A{Name: "example", Password: "hunter2", Token: "t0k3n", Address: B{City: "Istanbul"}})
+	s.KeyTransform = strings.ToLower
+
+	expected := map[string]interface{}{
+		"Name":    "example",
+		"Empty":   "",
+		"Token":   DefaultRedactWith,
+		"Address": map[string]interface{}{"City": "Istanbul"},
+	}
+
+	// fields tagged with "-" are never emitted and secrets are redacted
+	if m := s.GoNameMap(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("GoNameMap should return %v, got: %v", expected, m)
+	}
+
+	if m := s.Map(); m["name"] != "example" {
+		t.Errorf("Map should still use the tags, got: %v", m)
+	}
+}
+
+func TestMap_KeyFrom(t *testing.T) {
+	type pair struct {
+		Key   string `structs:"-"`
+		Value string `structs:",keyfrom=Key"`
+	}
+
+	m := Map(pair{Key: "color", Value: "red"})
+
+	expected := map[string]interface{}{"color": "red"}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should take the key from the Key field, expected %v, got: %v", expected, m)
+	}
+
+	type attr struct {
+		ID    int
+		Value string `structs:"value,keyfrom=ID"`
+		Other string `structs:"other,keyfrom=Missing"`
+	}
+
+	m = Map(attr{ID: 7, Value: "seven", Other: "other"})
+
+	expected = map[string]interface{}{"ID": 7, "7": "seven", "other": "other"}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should take the key from the ID field, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_VirtualFields(t *testing.T) {
+	type B struct {
+		Name string `structs:"name"`
+	}
+
+	type person struct {
+		Name      string    `structs:"name"`
+		BirthDate time.Time `structs:"birth_date"`
+		B         B         `structs:"b"`
+	}
+
+	birth := time.Now().AddDate(-30, 0, -1)
+
+	s := New(&person{Name: "example", BirthDate: birth, B: B{Name: "inner"}})
+	s.VirtualFields = map[string]func(interface{}) interface{}{
+		"age": func(v interface{}) interface{} {
+			return int(time.Since(v.(person).BirthDate).Hours() / 24 / 365.25)
+		},
+		"name": func(v interface{}) interface{} {
+			return "virtual"
+		},
+	}
+
+	m := s.Map()
+
+	if age := m["age"]; age != 30 {
+		t.Errorf("Map should add the virtual age field 30, got: %v", age)
+	}
+
+	if name := m["name"]; name != "example" {
+		t.Errorf("Map should prefer real fields over virtual fields, got: %v", name)
+	}
+
+	if b := m["b"].(map[string]interface{}); len(b) != 1 {
+		t.Errorf("Map should not add virtual fields to nested structs, got: %v", b)
+	}
+
+	kvs := s.OrderedMap()
+	if last := kvs[len(kvs)-1]; last.Key != "age" {
+		t.Errorf("OrderedMap should add virtual fields last, got: %v", last)
+	}
+}
+
+func TestMapE_Strict(t *testing.T) {
+	type B struct {
+		Callback func() `structs:"callback"`
+	}
+
+	type A struct {
+		Name    string      `structs:"name"`
+		Handler func()      `structs:"handler"`
+		Events  interface{} `structs:"events"`
+		B       B           `structs:"b"`
+	}
+
+	a := A{Name: "example", Handler: func() {}, Events: make(chan int)}
+
+	m, err := New(a).MapE()
+	if err != nil {
+		t.Fatalf("MapE should not return an error without Strict, got: %v", err)
+	}
+
+	expected := map[string]interface{}{"name": "example", "b": map[string]interface{}{}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapE should skip unsupported fields, expected %v, got: %v", expected, m)
+	}
+
+	s := New(a)
+	s.Strict = true
+
+	_, err = s.MapE()
+	if !errors.Is(err, ErrUnsupportedKind) {
+		t.Fatalf("MapE should return ErrUnsupportedKind in Strict mode, got: %v", err)
+	}
+
+	for _, key := range []string{"handler (Handler): ", "events (Events): ", "b.callback (Callback): "} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("MapE error should list %q, got: %v", key, err)
+		}
+	}
+
+	type C struct {
+		Callbacks []func()            `structs:"callbacks"`
+		ByName    map[string]B        `structs:"by_name"`
+		Events    []interface{}       `structs:"events"`
+		Channels  map[string]chan int `structs:"channels"`
+	}
+
+	c := C{
+		Callbacks: []func(){func() {}},
+		ByName:    map[string]B{"a": {Callback: func() {}}},
+		Events:    []interface{}{"event", make(chan int)},
+		Channels:  map[string]chan int{},
+	}
+
+	s = New(c)
+	s.Strict = true
+
+	errs := []string{
+		`callbacks (Callbacks): unsupported kind []func()`,
+		`by_name.a.callback (Callback): unsupported kind func`,
+		`events.1 (Events): unsupported kind chan`,
+		`channels (Channels): unsupported kind map[string]chan int`,
+	}
+
+	if _, err := s.MapE(); err == nil || err.Error() != strings.Join(errs, "\n") {
+		t.Errorf("MapE should report unsupported kinds in slices and maps, expected %q, got: %v", strings.Join(errs, "\n"), err)
+	}
+}
+
+func TestMap_TypedSliceMaps(t *testing.T) {
+	type address struct {
+		City string `structs:"city"`
+	}
+
+	type person struct {
+		Addresses []address `structs:"addresses"`
+	}
+
+	p := person{Addresses: []address{{City: "Paris"}, {City: "Rome"}}}
+
+	if _, ok := Map(p)["addresses"].([]interface{}); !ok {
+		t.Errorf("Map should emit []interface{} by default, got: %T", Map(p)["addresses"])
+	}
+
+	s := New(p)
+	s.TypedSliceMaps = true
+
+	addresses, ok := s.Map()["addresses"].([]map[string]interface{})
+	if !ok {
+		t.Fatalf("Map should emit []map[string]interface{} with TypedSliceMaps, got: %T", s.Map()["addresses"])
+	}
+
+	expected := []map[string]interface{}{{"city": "Paris"}, {"city": "Rome"}}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("Map should convert the addresses, expected %v, got: %v", expected, addresses)
+	}
+}
+
+func TestMap_UseErrorString(t *testing.T) {
+	type result struct {
+		Value int   `structs:"value"`
+		Err   error `structs:"err"`
+		Other error `structs:"other"`
+		Skip  error `structs:"skip,omitempty"`
+	}
+
+	r := result{Value: 1, Err: fmt.Errorf("loading config: %w", errors.New("not found"))}
+
+	if _, ok := Map(r)["err"].(error); !ok {
+		t.Errorf("Map should emit the error value by default, got: %T", Map(r)["err"])
+	}
+
+	s := New(r)
+	s.UseErrorString = true
+
+	expected := map[string]interface{}{
+		"value": 1,
+		"err":   "loading config: not found",
+		"other": nil,
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit the error messages, expected %v, got: %v", expected, m)
+	}
+
+	g := errorGetters{Status: errors.New("failed"), Cause: errors.New("timeout")}
+
+	s = New(g)
+	s.UseErrorString = true
+	s.UseGetters = true
+
+	expected = map[string]interface{}{
+		"status": "status: failed",
+		"cause":  "wrapped: timeout",
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit the values of getters with UseErrorString, expected %v, got: %v", expected, m)
+	}
+}
+
+type errorGetters struct {
+	Status error `structs:"status"`
+	Cause  error `structs:"cause"`
+}
+
+func (e errorGetters) GetStatus() string {
+	return "status: " + e.Status.Error()
+}
+
+func (e errorGetters) GetCause() error {
+	return fmt.Errorf("wrapped: %w", e.Cause)
+}
+
+func TestSortedPairs(t *testing.T) {
+	type B struct {
+		Tags map[string]int `structs:"tags"`
+	}
+
+	type A struct {
+		Name  string           `structs:"name"`
+		Ports map[string]int   `structs:"ports"`
+		B     B                `structs:"b"`
+		List  []B              `structs:"list"`
+		IDs   []int            `structs:"ids"`
+		Empty map[string]error `structs:"empty"`
+	}
+
+	a := A{
+		Name:  "example",
+		Ports: map[string]int{"https": 443, "http": 80, "ftp": 21},
+		B:     B{Tags: map[string]int{"z": 1, "a": 2}},
+		List:  []B{{Tags: map[string]int{"y": 1, "x": 2}}},
+		IDs:   []int{3, 1},
+	}
+
+	expected := []KeyValue{
+		{"b", []KeyValue{{"tags", []KeyValue{{"a", 2}, {"z", 1}}}}},
+		{"empty", nil},
+		{"ids", []int{3, 1}},
+		{"list", []interface{}{[]KeyValue{{"tags", []KeyValue{{"x", 2}, {"y", 1}}}}}},
+		{"name", "example"},
+		{"ports", []KeyValue{{"ftp", 21}, {"http", 80}, {"https", 443}}},
+	}
+
+	if pairs := New(a).SortedPairs(); !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("SortedPairs should sort keys at every level, expected %v, got: %v", expected, pairs)
+	}
+}
+
+func TestMap_NormalizeNumbers(t *testing.T) {
+	type A struct {
+		Small   int8          `structs:"small"`
+		Count   uint32        `structs:"count"`
+		Ratio   float32       `structs:"ratio"`
+		Timeout time.Duration `structs:"timeout"`
+		Ports   []uint16      `structs:"ports"`
+		Weights []float32     `structs:"weights"`
+		Huge    uint64        `structs:"huge"`
+		Data    []byte        `structs:"data"`
+		Name    string        `structs:"name"`
+	}
+
+	a := A{
+		Small:   -8,
+		Count:   32,
+		Ratio:   0.5,
+		Timeout: time.Second,
+		Ports:   []uint16{80, 443},
+		Weights: []float32{0.25},
+		Huge:    math.MaxUint64,
+		Data:    []byte("data"),
+		Name:    "example",
+	}
+
+	s := New(a)
+	s.NormalizeNumbers = true
+
+	expected := map[string]interface{}{
+		"small":   int64(-8),
+		"count":   int64(32),
+		"ratio":   float64(0.5),
+		"timeout": int64(time.Second),
+		"ports":   []int64{80, 443},
+		"weights": []float64{0.25},
+		"huge":    uint64(math.MaxUint64),
+		"data":    []byte("data"),
+		"name":    "example",
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should normalize numbers, expected %v, got: %v", expected, m)
+	}
+}
+
+type roleKey struct{}
+
+func TestMapContext(t *testing.T) {
+	type Account struct {
+		Name  string `structs:"name"`
+		Notes string `structs:"notes,admin"`
+	}
+
+	type User struct {
+		Name    string  `structs:"name"`
+		Salary  int     `structs:"salary,admin"`
+		Account Account `structs:"account"`
+	}
+
+	s := New(User{Name: "example", Salary: 100, Account: Account{Name: "main", Notes: "vip"}})
+	s.IncludeFunc = func(ctx context.Context, f *Field) bool {
+		_, tagOpts := parseTag(f.Tag("structs"))
+		return !tagOpts.Has("admin") || ctx.Value(roleKey{}) == "admin"
+	}
+
+	m := s.MapContext(context.WithValue(context.Background(), roleKey{}, "viewer"))
+
+	expected := map[string]interface{}{
+		"name":    "example",
+		"account": map[string]interface{}{"name": "main"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapContext should hide admin fields from viewers, expected %v, got: %v", expected, m)
+	}
+
+	m = s.MapContext(context.WithValue(context.Background(), roleKey{}, "admin"))
+
+	expected = map[string]interface{}{
+		"name":    "example",
+		"salary":  100,
+		"account": map[string]interface{}{"name": "main", "notes": "vip"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapContext should show admin fields to admins, expected %v, got: %v", expected, m)
+	}
+
+	if m := s.Map(); len(m) != 2 {
+		t.Errorf("Map should call IncludeFunc with a background context, got: %v", m)
+	}
+}
+
+func TestMap_NullValue(t *testing.T) {
+	type B struct {
+		Name *string `structs:"name"`
+	}
+
+	type A struct {
+		Ptr   *int              `structs:"ptr"`
+		Iface interface{}       `structs:"iface"`
+		Slice []string          `structs:"slice"`
+		Map   map[string]int    `structs:"map"`
+		Items []*B              `structs:"items"`
+		Skip  *int              `structs:"skip,omitempty"`
+		Set   map[string]string `structs:"set"`
+		B     B                 `structs:"b"`
+	}
+
+	a := A{Items: []*B{nil, {}}, Set: map[string]string{"a": "b"}}
+
+	s := New(a)
+	s.NullValue = "N/A"
+
+	expected := map[string]interface{}{
+		"ptr":   "N/A",
+		"iface": "N/A",
+		"slice": "N/A",
+		"map":   "N/A",
+		"items": []interface{}{"N/A", map[string]interface{}{"name": "N/A"}},
+		"set":   map[string]string{"a": "b"},
+		"b":     map[string]interface{}{"name": "N/A"},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit NullValue for nil values, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestStruct_ConcurrentReads(t *testing.T) {
+	type B struct {
+		Tags map[string]int `structs:"tags"`
+	}
+
+	type A struct {
+		Name  string `structs:"name,omitempty"`
+		Items []B    `structs:"items"`
+		B     *B     `structs:"b,flatten"`
+	}
+
+	s := New(&A{
+		Name:  "example",
+		Items: []B{{Tags: map[string]int{"a": 1}}},
+		B:     &B{Tags: map[string]int{"b": 2}},
+	})
+	s.OmitEmpty = true
+	if err := s.Rename("Name", "title"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := s.Map()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if m := s.Map(); !reflect.DeepEqual(m, expected) {
+					t.Errorf("Map should return %v, got: %v", expected, m)
+				}
+				s.Values()
+				s.OrderedMap()
+				s.NonZeroFields()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMap_EmptySliceAsNull(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		NilInts     []int
+		EmptyInts   []int
+		NilStructs  []B
+		EmptyStruct []B
+	}
+
+	a := A{EmptyInts: []int{}, EmptyStruct: []B{}}
+
+	tests := []struct {
+		nullify  bool
+		asEmpty  bool
+		expected map[string]interface{}
+		json     string
+	}{
+		{false, false, map[string]interface{}{
+			"NilInts":     []int(nil),
+			"EmptyInts":   []int{},
+			"NilStructs":  []B(nil),
+			"EmptyStruct": []interface{}{},
+		}, `{"EmptyInts":[],"EmptyStruct":[],"NilInts":null,"NilStructs":null}`},
+		{false, true, map[string]interface{}{
+			"NilInts":     []int{},
+			"EmptyInts":   []int{},
+			"NilStructs":  []interface{}{},
+			"EmptyStruct": []interface{}{},
+		}, `{"EmptyInts":[],"EmptyStruct":[],"NilInts":[],"NilStructs":[]}`},
+		{true, false, map[string]interface{}{
+			"NilInts":     []int(nil),
+			"EmptyInts":   []int(nil),
+			"NilStructs":  []B(nil),
+			"EmptyStruct": []B(nil),
+		}, `{"EmptyInts":null,"EmptyStruct":null,"NilInts":null,"NilStructs":null}`},
+		// only empty non-nil slices are nullified
+		{true, true, map[string]interface{}{
+			"NilInts":     []int{},
+			"EmptyInts":   []int(nil),
+			"NilStructs":  []interface{}{},
+			"EmptyStruct": []B(nil),
+		}, `{"EmptyInts":null,"EmptyStruct":null,"NilInts":[],"NilStructs":[]}`},
+	}
+
+	for _, test := range tests {
+		s := New(a)
+		s.EmptySliceAsNull = test.nullify
+		s.NilSliceAsEmpty = test.asEmpty
+
+		if m := s.Map(); !reflect.DeepEqual(m, test.expected) {
+			t.Errorf("Map with EmptySliceAsNull %t and NilSliceAsEmpty %t should return %#v, got: %#v",
+				test.nullify, test.asEmpty, test.expected, m)
+		}
+
+		if b, _ := json.Marshal(s.Map()); string(b) != test.json {
+			t.Errorf("Map with EmptySliceAsNull %t and NilSliceAsEmpty %t should serialize to %s, got: %s",
+				test.nullify, test.asEmpty, test.json, b)
+		}
+	}
+}
+
+func TestMap_EmptyStructSlices(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		Empty []B
+		Items []B
+	}
+
+	a := A{Empty: []B{}, Items: []B{{Name: "a"}}}
+
+	// empty slices of structs have the same type as non-empty ones
+	m := Map(a)
+	if _, ok := m["Empty"].([]interface{}); !ok {
+		t.Errorf("Map should emit an empty []interface{}, got: %#v", m["Empty"])
+	}
+	if _, ok := m["Items"].([]interface{}); !ok {
+		t.Errorf("Map should emit a []interface{}, got: %#v", m["Items"])
+	}
+
+	s := New(a)
+	s.TypedSliceMaps = true
+
+	m = s.Map()
+	if _, ok := m["Empty"].([]map[string]interface{}); !ok {
+		t.Errorf("Map with TypedSliceMaps should emit an empty []map[string]interface{}, got: %#v", m["Empty"])
+	}
+	if _, ok := m["Items"].([]map[string]interface{}); !ok {
+		t.Errorf("Map with TypedSliceMaps should emit a []map[string]interface{}, got: %#v", m["Items"])
+	}
+}
+
+func TestMap_Formatters(t *testing.T) {
+	type B struct {
+		Email string `structs:"email"`
+	}
+
+	type A struct {
+		Email string `structs:"email"`
+		Phone string `structs:"phone"`
+		Level int    `structs:"level"`
+		B     B      `structs:"b"`
+	}
+
+	a := A{Email: "jane@example.com", Phone: "5551234567", Level: 3, B: B{Email: "john@example.com"}}
+
+	s := New(a)
+	s.EnumTables = map[string]map[int]string{"level": {3: "high"}}
+	s.Formatters = map[string]func(interface{}) interface{}{
+		"email": func(v interface{}) interface{} {
+			user, domain, _ := strings.Cut(v.(string), "@")
+			return user[:1] + "***@" + domain
+		},
+		"phone": func(v interface{}) interface{} {
+			p := v.(string)
+			return fmt.Sprintf("(%s) %s-%s", p[:3], p[3:6], p[6:])
+		},
+		"level": func(v interface{}) interface{} {
+			return v.(int) * 10
+		},
+	}
+
+	expected := map[string]interface{}{
+		"email": "j***@example.com",
+		"phone": "(555) 123-4567",
+		"level": 30,
+		"b":     map[string]interface{}{"email": "j***@example.com"},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should apply the formatters, expected %v, got: %v", expected, m)
+	}
+}
+
+type embeddedTime struct {
+	time.Time
+}
+
+func TestMap_EmbeddedTime(t *testing.T) {
+	type A struct {
+		Created embeddedTime  `structs:"created"`
+		Updated *embeddedTime `structs:"updated"`
+		Plain   time.Time     `structs:"plain"`
+	}
+
+	now := time.Now()
+	a := A{Created: embeddedTime{now}, Updated: &embeddedTime{now}, Plain: now}
+
+	expected := map[string]interface{}{
+		"created": map[string]interface{}{"Time": now},
+		"updated": map[string]interface{}{"Time": now},
+		"plain":   now,
+	}
+
+	if m := Map(a); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should recurse into types embedding time.Time, expected %v, got: %v", expected, m)
+	}
+
+	s := New(a)
+	s.LeafTypes = []reflect.Type{reflect.TypeOf(embeddedTime{})}
+
+	expected = map[string]interface{}{
+		"created": embeddedTime{now},
+		"updated": &embeddedTime{now},
+		"plain":   now,
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit leaf types as is, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_Labeled(t *testing.T) {
+	type status int
+
+	type account struct {
+		Status status `structs:"status,labeled"`
+		Role   string `structs:"role,labeled"`
+		Level  int    `structs:"level,labeled"`
+		Plain  int    `structs:"plain"`
+	}
+
+	s := New(account{Status: 2, Role: "admin", Level: 9, Plain: 2})
+	s.Labels = map[string]map[interface{}]string{
+		"status": {1: "Pending", 2: "Active"},
+		"role":   {"admin": "Administrator"},
+		"level":  {1: "Low"},
+		"plain":  {2: "Active"},
+	}
+
+	expected := map[string]interface{}{
+		"status": map[string]interface{}{"value": status(2), "label": "Active"},
+		"role":   map[string]interface{}{"value": "admin", "label": "Administrator"},
+		"level":  9,
+		"plain":  2,
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit labeled fields, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestMap_LabeledUncomparable(t *testing.T) {
+	type A struct {
+		Tags  []int          `structs:"tags,labeled"`
+		Attrs map[string]int `structs:"attrs,labeled"`
+	}
+
+	s := New(A{Tags: []int{1}, Attrs: map[string]int{"a": 1}})
+	s.Labels = map[string]map[interface{}]string{
+		"tags":  {1: "One"},
+		"attrs": {1: "One"},
+	}
+
+	expected := map[string]interface{}{
+		"tags":  []int{1},
+		"attrs": map[string]int{"a": 1},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit the raw values of uncomparable labeled fields, expected %v, got: %v", expected, m)
+	}
+}
+
+func TestWillEmit(t *testing.T) {
+	type B struct {
+		City string `structs:"city,omitempty"`
+	}
+
+	type A struct {
+		Name   string `structs:"name"`
+		Nick   string `structs:"nick,omitempty"`
+		Count  int    `structs:"count,omitempty"`
+		Skip   string `structs:"-"`
+		Inner  B      `structs:",flatten"`
+		Online bool   `structs:"online,string"`
+	}
+
+	a := A{Name: "example", Count: 1, Inner: B{City: "Paris"}}
+
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"name", true},
+		{"nick", false},
+		{"count", true},
+		{"Skip", false},
+		{"city", true},
+		{"online", false},
+		{"missing", false},
+	}
+
+	s := New(a)
+	for _, test := range tests {
+		if got := s.WillEmit(test.key); got != test.expected {
+			t.Errorf("WillEmit(%q) should return %t, got: %t", test.key, test.expected, got)
+		}
+
+		if _, ok := s.Map()[test.key]; ok != test.expected {
+			t.Errorf("Map should agree with WillEmit(%q), got: %t", test.key, ok)
+		}
+	}
+
+	type C struct {
+		Name string `structs:"name"`
+		Nick string `structs:"nick,omitempty"`
+	}
+
+	s = New(C{Name: "example"})
+	if s.WillEmit("nick") {
+		t.Error("WillEmit should return false for a key dropped by omitempty")
+	}
+
+	if !s.WillEmit("name") {
+		t.Error("WillEmit should return true for an emitted key")
+	}
+
+	s = New(a)
+	s.Formatters = map[string]func(interface{}) interface{}{
+		"online": func(v interface{}) interface{} { return fmt.Sprint(v) },
+	}
+
+	if _, ok := s.Map()["online"]; !ok || !s.WillEmit("online") {
+		t.Error("WillEmit should return true for a string field with a Formatter")
+	}
+}
+
+func TestWillEmit_Flatten(t *testing.T) {
+	type B struct {
+		City string `structs:"city"`
+	}
+
+	type A struct {
+		Name    string    `structs:"name"`
+		Created time.Time `structs:"created"`
+		Inner   *B
+		Missing *B `structs:"missing"`
+		Any     interface{}
+	}
+
+	a := A{Name: "example", Inner: &B{City: "Paris"}, Any: struct{ Zone string }{"eu"}}
+
+	calls := 0
+	s := New(a)
+	s.Flatten = true
+	s.Formatters = map[string]func(interface{}) interface{}{
+		"city": func(v interface{}) interface{} {
+			calls++
+			return v
+		},
+	}
+
+	m := s.Map()
+	calls = 0
+
+	for _, key := range []string{"name", "created", "city", "missing", "Zone", "Inner", "Any"} {
+		_, ok := m[key]
+		if got := s.WillEmit(key); got != ok {
+			t.Errorf("WillEmit(%q) should agree with Map and return %t, got: %t", key, ok, got)
+		}
+	}
+
+	// the values are not converted to resolve the keys
+	if calls != 0 {
+		t.Errorf("WillEmit should not convert the values, got %d Formatter calls", calls)
+	}
+}
+
+func TestMap_SkipKinds(t *testing.T) {
+	type B struct {
+		Name *string `structs:"name"`
+		ID   int     `structs:"id"`
+	}
+
+	type A struct {
+		Name    string                 `structs:"name"`
+		Parent  *A                     `structs:"parent"`
+		Handler func()                 `structs:"handler"`
+		Any     interface{}            `structs:"any"`
+		Meta    map[string]interface{} `structs:"meta"`
+		B       B                      `structs:"b"`
+	}
+
+	name := "inner"
+	a := A{Name: "example", Parent: &A{}, Any: &name, Meta: map[string]interface{}{"a": 1}, B: B{Name: &name, ID: 1}}
+
+	s := New(a)
+	s.SkipKinds = []reflect.Kind{reflect.Ptr, reflect.Map}
+
+	expected := map[string]interface{}{
+		"name": "example",
+		"any":  &name,
+		"b":    map[string]interface{}{"id": 1},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should skip the fields of the given kinds, expected %v, got: %v", expected, m)
+	}
+
+	s.SkipKinds = []reflect.Kind{reflect.Func}
+	s.Strict = true
+
+	if _, err := s.MapE(); err != nil {
+		t.Errorf("MapE should not report skipped fields, got: %v", err)
+	}
+}
+
+func TestMap_OnDuplicateKey(t *testing.T) {
+	type B struct {
+		UserID string
+		UserId string
+	}
+
+	type A struct {
+		UserID string
+		UserId string
+		B      B `structs:"b"`
+	}
+
+	snake := func(name string) string {
+		var b strings.Builder
+		for i, r := range name {
+			if i > 0 && unicode.IsUpper(r) && unicode.IsLower(rune(name[i-1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		}
+		return b.String()
+	}
+
+	a := A{UserID: "first", UserId: "last", B: B{UserID: "inner first", UserId: "inner last"}}
+
+	tests := []struct {
+		policy   DuplicateKeyPolicy
+		expected map[string]interface{}
+	}{
+		{DuplicateKeepLast, map[string]interface{}{
+			"user_id": "last",
+			"b":       map[string]interface{}{"user_id": "inner last"},
+		}},
+		{DuplicateKeepFirst, map[string]interface{}{
+			"user_id": "first",
+			"b":       map[string]interface{}{"user_id": "inner first"},
+		}},
+		{DuplicateError, map[string]interface{}{
+			"user_id": "last",
+			"b":       map[string]interface{}{"user_id": "inner last"},
+		}},
+	}
+
+	for _, test := range tests {
+		s := New(a)
+		s.KeyTransform = snake
+		s.OnDuplicateKey = test.policy
+
+		for i := 0; i < 5; i++ {
+			if m := s.Map(); !reflect.DeepEqual(m, test.expected) {
+				t.Errorf("Map with policy %d should return %v, got: %v", test.policy, test.expected, m)
+			}
+		}
+
+		kvs := s.OrderedMap()
+		if len(kvs) != 2 || kvs[0].Key != "user_id" || kvs[0].Value != test.expected["user_id"] {
+			t.Errorf("OrderedMap with policy %d should return %v first, got: %v", test.policy, test.expected["user_id"], kvs)
+		}
+
+		_, err := s.MapE()
+		if test.policy != DuplicateError {
+			if err != nil {
+				t.Errorf("MapE with policy %d should not return an error, got: %v", test.policy, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("MapE should return ErrDuplicateKey, got: %v", err)
+		}
+
+		if expected := "duplicate key: user_id\nb: duplicate key: user_id"; err.Error() != expected {
+			t.Errorf("MapE should return %q, got: %q", expected, err)
+		}
+	}
+}
+
+func TestMap_DuplicateSuffix(t *testing.T) {
+	type Person struct {
+		Name string
+		Age  int
+	}
+
+	type OtherStruct struct {
+		Name string
+	}
+
+	type A struct {
+		Person      `structs:",flatten"`
+		OtherStruct `structs:",flatten"`
+		Label       string `structs:"Name"`
+	}
+
+	a := A{Person: Person{Name: "person", Age: 30}, OtherStruct: OtherStruct{Name: "other"}, Label: "label"}
+
+	s := New(a)
+	s.OnDuplicateKey = DuplicateSuffix
+
+	expected := []KeyValue{
+		{"Name", "person"},
+		{"Age", 30},
+		{"Name_OtherStruct", "other"},
+		{"Name_Label", "label"},
+	}
+
+	for i := 0; i < 5; i++ {
+		if kvs := s.OrderedMap(); !reflect.DeepEqual(kvs, expected) {
+			t.Fatalf("OrderedMap should suffix duplicate keys, expected %v, got: %v", expected, kvs)
+		}
+	}
+
+	m := s.Map()
+	if len(m) != 4 || m["Name"] != "person" || m["Name_OtherStruct"] != "other" || m["Name_Label"] != "label" {
+		t.Errorf("Map should suffix duplicate keys, got: %v", m)
+	}
+
+	if !s.WillEmit("Name_Label") || s.WillEmit("Label") {
+		t.Error("WillEmit should report the suffixed keys")
+	}
+
+	if _, err := s.MapE(); err != nil {
+		t.Errorf("MapE should not return an error for suffixed keys, got: %v", err)
+	}
+}
+
+func TestMap_WithLen(t *testing.T) {
+	type order struct {
+		Items []string          `structs:"items,withlen=item_count"`
+		Tags  map[string]string `structs:"tags,withlen=tag_count"`
+		Notes *[]string         `structs:"notes,withlen=note_count"`
+		Name  string            `structs:"name"`
+	}
+
+	o := order{Items: []string{"a", "b", "c"}, Name: "example"}
+
+	expected := map[string]interface{}{
+		"items":      []string{"a", "b", "c"},
+		"item_count": 3,
+		"tags":       map[string]string(nil),
+		"tag_count":  0,
+		"notes":      (*[]string)(nil),
+		"note_count": 0,
+		"name":       "example",
+	}
+
+	if m := Map(o); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit the lengths, expected %v, got: %v", expected, m)
+	}
+
+	if !New(o).WillEmit("item_count") {
+		t.Error("WillEmit should return true for the length key")
+	}
+
+	kvs := New(o).OrderedMap()
+	if kvs[0].Key != "items" || kvs[1].Key != "item_count" {
+		t.Errorf("OrderedMap should emit the length after the value, got: %v", kvs)
+	}
+}
+
+func TestMap_WithLenInterface(t *testing.T) {
+	type A struct {
+		Nil   interface{} `structs:"nil,withlen=nil_count"`
+		Items interface{} `structs:"items,withlen=item_count"`
+	}
+
+	expected := map[string]interface{}{
+		"nil":        nil,
+		"nil_count":  0,
+		"items":      []int{1, 2},
+		"item_count": 2,
+	}
+
+	if m := Map(A{Items: []int{1, 2}}); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should emit the lengths of interface fields, expected %v, got: %v", expected, m)
+	}
+}
+
+type refNode struct {
+	Name string   `structs:"name"`
+	Next *refNode `structs:"next"`
+}
+
+func TestMap_DedupPointers(t *testing.T) {
+	type A struct {
+		Name string `structs:"name"`
+	}
+
+	type B struct {
+		First  *A   `structs:"first"`
+		Second *A   `structs:"second"`
+		Other  *A   `structs:"other"`
+		List   []*A `structs:"list"`
+	}
+
+	a := &A{Name: "shared"}
+	b := B{First: a, Second: a, Other: &A{Name: "other"}, List: []*A{a}}
+
+	s := New(b)
+	s.DedupPointers = true
+
+	expected := map[string]interface{}{
+		"first":  map[string]interface{}{"$id": 1, "name": "shared"},
+		"second": map[string]interface{}{"$ref": 1},
+		"other":  map[string]interface{}{"$id": 2, "name": "other"},
+		"list":   []interface{}{map[string]interface{}{"$ref": 1}},
+	}
+
+	for i := 0; i < 2; i++ {
+		if m := s.Map(); !reflect.DeepEqual(m, expected) {
+			t.Errorf("Map should emit repeated pointers as references, expected %v, got: %v", expected, m)
+		}
+	}
+
+	if m := Map(b); !reflect.DeepEqual(m["second"], map[string]interface{}{"name": "shared"}) {
+		t.Errorf("Map should convert repeated pointers by default, got: %v", m["second"])
+	}
+
+	first := &refNode{Name: "first"}
+	first.Next = &refNode{Name: "second", Next: first}
+
+	s = New(refNode{Name: "root", Next: first})
+	s.DedupPointers = true
+
+	expected = map[string]interface{}{
+		"name": "root",
+		"next": map[string]interface{}{
+			"$id":  1,
+			"name": "first",
+			"next": map[string]interface{}{
+				"$id":  2,
+				"name": "second",
+				"next": map[string]interface{}{"$ref": 1},
+			},
+		},
+	}
+
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should convert cyclic values, expected %v, got: %v", expected, m)
+	}
+
+	if m, err := s.MapE(); err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapE should convert cyclic values, expected %v, got: %v, %v", expected, m, err)
+	}
+
+	self := &refNode{Name: "self"}
+	self.Next = self
+
+	s = New(self)
+	s.DedupPointers = true
+	s.Strict = true
+
+	expected = map[string]interface{}{
+		"name": "self",
+		"next": map[string]interface{}{
+			"$id":  1,
+			"name": "self",
+			"next": map[string]interface{}{"$ref": 1},
+		},
+	}
+
+	if m, err := s.MapE(); err != nil || !reflect.DeepEqual(m, expected) {
+		t.Errorf("MapE should convert self-referencing values, expected %v, got: %v, %v", expected, m, err)
+	}
+}
+
+type prices []float64
+
+func TestMap_PrecisionNamedSlice(t *testing.T) {
+	type A struct {
+		Prices prices `structs:"prices,precision=1"`
+	}
+
+	m := Map(A{Prices: prices{1.25, 2.04}})
+
+	if p, ok := m["prices"].(prices); !ok || !reflect.DeepEqual(p, prices{1.3, 2}) {
+		t.Errorf("Map should keep the named slice type when rounding, got: %#v", m["prices"])
+	}
+}
+
+func TestMap_Precision(t *testing.T) {
+	type A struct {
+		Price   float64    `structs:"price,precision=2"`
+		Ratio   float32    `structs:"ratio,precision=1"`
+		Whole   float64    `structs:"whole,precision=0"`
+		Samples []float64  `structs:"samples,precision=2"`
+		Fixed   [2]float32 `structs:"fixed,precision=1"`
+		Count   int        `structs:"count,precision=2"`
+		Raw     float64    `structs:"raw"`
+	}
+
+	a := A{
+		Price:   3.14159,
+		Ratio:   0.66,
+		Whole:   2.5,
+		Samples: []float64{1.004, 2.71828},
+		Fixed:   [2]float32{1.25, 9.99},
+		Count:   7,
+		Raw:     3.14159,
+	}
+
+	expected := map[string]interface{}{
+		"price":   3.14,
+		"ratio":   float32(0.7),
+		"whole":   float64(3),
+		"samples": []float64{1.0, 2.72},
+		"fixed":   [2]float32{1.3, 10},
+		"count":   7,
+		"raw":     3.14159,
+	}
+
+	if m := Map(a); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should round floats with the precision option, expected %v, got: %v", expected, m)
+	}
+
+	if a.Samples[1] != 2.71828 {
+		t.Errorf("Map should not modify the rounded slice, got: %v", a.Samples)
+	}
+}
+
+func TestMap_Join(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type A struct {
+		Tags   []string  `structs:"tags,join=,"`
+		Ports  [3]int    `structs:"ports,join=;"`
+		Flags  *[]bool   `structs:"flags,join=|"`
+		Empty  []float64 `structs:"empty,join=,"`
+		Nested []B       `structs:"nested,join=,"`
+	}
+
+	a := A{
+		Tags:   []string{"a", "b"},
+		Ports:  [3]int{80, 443, 8080},
+		Nested: []B{{Name: "b"}},
+	}
+
+	expected := map[string]interface{}{
+		"tags":   "a,b",
+		"ports":  "80;443;8080",
+		"flags":  "",
+		"empty":  "",
+		"nested": []interface{}{map[string]interface{}{"Name": "b"}},
+	}
+
+	s := New(a)
+	if m := s.Map(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Map should join scalar slices with the join option, expected %v, got: %v", expected, m)
+	}
+
+	_, err := s.MapE()
+	var fieldErr *FieldError
+	if !errors.Is(err, ErrUnsupportedKind) || !errors.As(err, &fieldErr) || fieldErr.Path != "nested" {
+		t.Errorf("MapE should return ErrUnsupportedKind for joined non-scalar slices, got: %v", err)
+	}
+
+	if errs := s.ValidateTags(); len(errs) != 0 {
+		t.Errorf("ValidateTags should accept the separator as the join value, got: %v", errs)
+	}
+}
+
+func TestMapE_JoinEmittedFields(t *testing.T) {
+	type B struct {
+		Name string
+	}
+
+	type Item struct {
+		Nested []B `structs:"nested,join=,"`
+	}
+
+	type A struct {
+		Empty []B    `structs:"empty,omitempty,join=,"`
+		Items []Item `structs:"items"`
+	}
+
+	_, err := New(A{Items: []Item{{Nested: []B{{Name: "b"}}}}}).MapE()
+
+	var fieldErr *FieldError
+	if !errors.Is(err, ErrUnsupportedKind) || !errors.As(err, &fieldErr) || fieldErr.Path != "items.0.nested" {
+		t.Errorf("MapE should return ErrUnsupportedKind for joined non-scalar slices in slices, got: %v", err)
+	}
+
+	if _, err := New(A{}).MapE(); err != nil {
+		t.Errorf("MapE should not check the join option of omitted fields, got: %v", err)
+	}
+}
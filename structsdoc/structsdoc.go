@@ -0,0 +1,130 @@
+// Package structsdoc extracts the documentation of struct fields from their
+// source code, ie: for generating API docs alongside the output of the
+// structs package. It lives in its own package so the go/ast parser stays
+// out of the structs package.
+package structsdoc
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	structs "github.com/rajasoun/go-ds"
+)
+
+// FieldDocs parses the source of the package at pkgPath, which is either a
+// directory or an import path, and returns the doc comments of the fields of
+// the struct type typeName. Fields are keyed in the same way as the output of
+// structs.Map, ie: by their structs.DefaultTagName tag name or their Go name.
+// Fields without a doc comment use their line comment, if any, and fields
+// tagged with "-" or without any comment are left out. Test files are not
+// parsed. An error is returned if the package can't be parsed or doesn't
+// declare typeName as a struct.
+func FieldDocs(pkgPath, typeName string) (map[string]string, error) {
+	dir, err := packageDir(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		if st, ok := findStruct(f, typeName); ok {
+			return fieldDocs(st), nil
+		}
+	}
+
+	return nil, fmt.Errorf("struct %s not found in %s", typeName, pkgPath)
+}
+
+// packageDir returns the directory of the package at pkgPath.
+func packageDir(pkgPath string) (string, error) {
+	if info, err := os.Stat(pkgPath); err == nil && info.IsDir() {
+		return pkgPath, nil
+	}
+
+	pkg, err := build.Import(pkgPath, ".", build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+
+	return pkg.Dir, nil
+}
+
+// findStruct returns the struct type declared as name in f.
+func findStruct(f *ast.File, name string) (*ast.StructType, bool) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != name {
+				continue
+			}
+
+			st, ok := ts.Type.(*ast.StructType)
+			return st, ok
+		}
+	}
+
+	return nil, false
+}
+
+func fieldDocs(st *ast.StructType) map[string]string {
+	docs := make(map[string]string)
+
+	for _, field := range st.Fields.List {
+		doc := strings.TrimSpace(field.Doc.Text())
+		if doc == "" {
+			doc = strings.TrimSpace(field.Comment.Text())
+		}
+
+		var tagName string
+		if field.Tag != nil {
+			if tag, err := strconv.Unquote(field.Tag.Value); err == nil {
+				tagName, _, _ = strings.Cut(reflect.StructTag(tag).Get(structs.DefaultTagName), ",")
+			}
+		}
+
+		if doc == "" || tagName == "-" {
+			continue
+		}
+
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+
+			key := tagName
+			if key == "" {
+				key = name.Name
+			}
+			docs[key] = doc
+		}
+	}
+
+	return docs
+}
@@ -0,0 +1,30 @@
+package structsdoc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldDocs(t *testing.T) {
+	docs, err := FieldDocs("testdata/fixture", "Config")
+	if err != nil {
+		t.Fatalf("FieldDocs should not return an error, got: %s", err)
+	}
+
+	expected := map[string]string{
+		"name":  "Name is the name of the service.",
+		"port":  "Port is the port the service\nlistens on.",
+		"Debug": "Debug enables verbose logging.",
+		"Host":  "Host has no tag name.",
+	}
+
+	if !reflect.DeepEqual(docs, expected) {
+		t.Errorf("FieldDocs should return %v, got: %v", expected, docs)
+	}
+}
+
+func TestFieldDocs_NotFound(t *testing.T) {
+	if _, err := FieldDocs("testdata/fixture", "Missing"); err == nil {
+		t.Error("FieldDocs should return an error for a missing type")
+	}
+}
@@ -0,0 +1,24 @@
+package fixture
+
+// Config is a fixture for FieldDocs.
+type Config struct {
+	// Name is the name of the service.
+	Name string `structs:"name"`
+
+	// Port is the port the service
+	// listens on.
+	Port int `structs:"port,omitempty"`
+
+	Debug bool // Debug enables verbose logging.
+
+	// Host has no tag name.
+	Host string
+
+	// Secret is never emitted.
+	Secret string `structs:"-"`
+
+	// internal is not exported.
+	internal string
+
+	Undocumented string `structs:"undocumented"`
+}
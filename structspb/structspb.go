@@ -0,0 +1,125 @@
+// Package structspb converts structs into protobuf's well-known
+// google.protobuf.Struct type. It lives in its own package so the protobuf
+// dependency stays optional for users of the structs package.
+package structspb
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"time"
+
+	structs "github.com/rajasoun/go-ds"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ToStructpb converts the given struct to a *structpb.Struct. The fields,
+// keys and tag options are the same as returned by s.Map(), but the struct
+// is walked directly with s.Walk instead of being converted into a map
+// first. Values follow structpb's rules: all numbers become float64, []byte
+// becomes a base64 string, time.Time an RFC 3339 string, slices and arrays
+// become lists and maps and nested structs become structs. An error is
+// returned for values that can't be represented, such as channels or funcs.
+func ToStructpb(s *structs.Struct) (*structpb.Struct, error) {
+	out := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+
+	err := s.Walk(func(key string, value interface{}) error {
+		val, err := toValue(reflect.ValueOf(value))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		out.Fields[key] = val
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func toStruct(v reflect.Value) (*structpb.Struct, error) {
+	out := &structpb.Struct{Fields: make(map[string]*structpb.Value, v.Len())}
+
+	for _, k := range v.MapKeys() {
+		key := fmt.Sprint(k.Interface())
+
+		val, err := toValue(v.MapIndex(k))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+
+		out.Fields[key] = val
+	}
+
+	return out, nil
+}
+
+func toValue(v reflect.Value) (*structpb.Value, error) {
+	if n, ok := nestedStruct(v); ok {
+		st, err := ToStructpb(n)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewStructValue(st), nil
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return structpb.NewNullValue(), nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return structpb.NewNullValue(), nil
+	case reflect.Bool:
+		return structpb.NewBoolValue(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return structpb.NewNumberValue(float64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return structpb.NewNumberValue(float64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return structpb.NewNumberValue(v.Float()), nil
+	case reflect.String:
+		return structpb.NewStringValue(v.String()), nil
+	case reflect.Map:
+		st, err := toStruct(v)
+		if err != nil {
+			return nil, err
+		}
+		return structpb.NewStructValue(st), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return structpb.NewStringValue(base64.StdEncoding.EncodeToString(v.Bytes())), nil
+		}
+
+		list := &structpb.ListValue{Values: make([]*structpb.Value, v.Len())}
+		for i := 0; i < v.Len(); i++ {
+			val, err := toValue(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("%d: %w", i, err)
+			}
+			list.Values[i] = val
+		}
+		return structpb.NewListValue(list), nil
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return structpb.NewStringValue(t.Format(time.RFC3339Nano)), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// nestedStruct returns the nested struct passed by Walk held in v.
+func nestedStruct(v reflect.Value) (*structs.Struct, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+
+	n, ok := v.Interface().(*structs.Struct)
+	return n, ok && n != nil
+}
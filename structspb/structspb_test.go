@@ -0,0 +1,130 @@
+package structspb
+
+import (
+	"testing"
+
+	structs "github.com/rajasoun/go-ds"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestToStructpb(t *testing.T) {
+	type address struct {
+		City string `structs:"city"`
+		Zip  int    `structs:"zip"`
+	}
+
+	type user struct {
+		Name      string    `structs:"name"`
+		Age       uint8     `structs:"age"`
+		Admin     bool      `structs:"admin"`
+		Address   *address  `structs:"address"`
+		Ports     []int     `structs:"ports"`
+		Addresses []address `structs:"addresses"`
+		Manager   *address  `structs:"manager"`
+	}
+
+	u := user{
+		Name:      "example",
+		Age:       42,
+		Admin:     true,
+		Address:   &address{City: "Istanbul", Zip: 34000},
+		Ports:     []int{80, 443},
+		Addresses: []address{{City: "Ankara", Zip: 6000}},
+	}
+
+	got, err := ToStructpb(structs.New(u))
+	if err != nil {
+		t.Fatalf("ToStructpb should not return an error, got: %s", err)
+	}
+
+	expected, err := structpb.NewStruct(map[string]interface{}{
+		"name":  "example",
+		"age":   42,
+		"admin": true,
+		"address": map[string]interface{}{
+			"city": "Istanbul",
+			"zip":  34000,
+		},
+		"ports": []interface{}{80, 443},
+		"addresses": []interface{}{
+			map[string]interface{}{"city": "Ankara", "zip": 6000},
+		},
+		"manager": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !proto.Equal(got, expected) {
+		t.Errorf("ToStructpb should return %v, got: %v", expected, got)
+	}
+}
+
+func TestToStructpb_Options(t *testing.T) {
+	type node struct {
+		Name string `structs:"name"`
+		Next *node  `structs:"next"`
+	}
+
+	type meta struct {
+		Zone string `structs:"zone"`
+	}
+
+	type A struct {
+		meta `structs:",flatten"`
+		Head *node `structs:"head"`
+	}
+
+	n := &node{Name: "a"}
+	n.Next = n
+
+	s := structs.New(A{meta: meta{Zone: "eu"}, Head: n})
+	s.DedupPointers = true
+
+	got, err := ToStructpb(s)
+	if err != nil {
+		t.Fatalf("ToStructpb should not return an error, got: %s", err)
+	}
+
+	expected, err := structpb.NewStruct(map[string]interface{}{
+		"zone": "eu",
+		"head": map[string]interface{}{
+			"$id":  1,
+			"name": "a",
+			"next": map[string]interface{}{"$ref": 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !proto.Equal(got, expected) {
+		t.Errorf("ToStructpb should return %v, got: %v", expected, got)
+	}
+}
+
+func TestToStructpb_Unsupported(t *testing.T) {
+	type A struct {
+		Name string
+		C    chan int
+	}
+
+	// channels are skipped by Map
+	got, err := ToStructpb(structs.New(A{Name: "example", C: make(chan int)}))
+	if err != nil {
+		t.Fatalf("ToStructpb should skip channel fields, got: %v", err)
+	}
+
+	if _, ok := got.Fields["C"]; ok || len(got.Fields) != 1 {
+		t.Errorf("ToStructpb should not convert channel fields, got: %v", got)
+	}
+
+	type B struct {
+		C complex64
+	}
+
+	if _, err := ToStructpb(structs.New(B{C: 1i})); err == nil {
+		t.Error("ToStructpb should return an error for a complex field")
+	}
+}
@@ -0,0 +1,48 @@
+package structs
+
+import (
+	"reflect"
+)
+
+// Node is a single key of a struct's output, as returned by Tree. Nodes of
+// nested structs have their Children set and a nil Value, while the other
+// nodes have their Value set and nil Children.
+type Node struct {
+	Key      string
+	Value    interface{}
+	Children []Node
+}
+
+// Tree returns the output of OrderedMap as a tree, ie: for rendering
+// collapsible tree views. Nested structs are converted to nodes whose
+// Children are the nodes of their fields in declaration order. Other values,
+// including maps and slices, are leaves with the same value as in Map.
+func (s *Struct) Tree() []Node {
+	structs := make(map[string]reflect.Value)
+	for _, field := range s.structFields() {
+		v := s.value.FieldByIndex(field.Index)
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				break
+			}
+			v = v.Elem()
+		}
+
+		if v.Kind() == reflect.Struct {
+			structs[s.fieldKey(field)] = v
+		}
+	}
+
+	var nodes []Node
+	for _, kv := range s.OrderedMap() {
+		v, ok := structs[kv.Key]
+		if _, isMap := kv.Value.(map[string]interface{}); ok && isMap {
+			nodes = append(nodes, Node{Key: kv.Key, Children: s.sub(v.Interface()).Tree()})
+			continue
+		}
+
+		nodes = append(nodes, Node{Key: kv.Key, Value: kv.Value})
+	}
+
+	return nodes
+}
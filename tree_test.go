@@ -0,0 +1,45 @@
+package structs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	type address struct {
+		Street string            `structs:"street"`
+		City   string            `structs:"city"`
+		Zip    int               `structs:"zip"`
+		Extra  map[string]string `structs:"extra"`
+	}
+
+	type person struct {
+		Name    string   `structs:"name"`
+		Address *address `structs:"address"`
+		Tags    []string `structs:"tags"`
+		Age     int      `structs:"age"`
+	}
+
+	p := person{
+		Name:    "example",
+		Address: &address{Street: "Main", City: "Paris", Zip: 75000, Extra: map[string]string{"b": "2", "a": "1"}},
+		Tags:    []string{"x"},
+		Age:     30,
+	}
+
+	expected := []Node{
+		{Key: "name", Value: "example"},
+		{Key: "address", Children: []Node{
+			{Key: "street", Value: "Main"},
+			{Key: "city", Value: "Paris"},
+			{Key: "zip", Value: 75000},
+			{Key: "extra", Value: map[string]string{"a": "1", "b": "2"}},
+		}},
+		{Key: "tags", Value: []string{"x"}},
+		{Key: "age", Value: 30},
+	}
+
+	if tree := New(p).Tree(); !reflect.DeepEqual(tree, expected) {
+		t.Errorf("Tree should return %+v, got: %+v", expected, tree)
+	}
+}
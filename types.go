@@ -0,0 +1,44 @@
+package structs
+
+import (
+	"reflect"
+)
+
+// ReachableTypes returns every distinct struct type reachable from the type
+// of sample, including itself, through the exported and embedded fields of
+// structs, pointers, slices, arrays and the keys and values of maps. Types
+// are returned once, in depth-first declaration order, and recursive types
+// are handled. Struct types without exported fields, ie: time.Time, are
+// returned too. sample may be a nil pointer, as only its type is used.
+func ReachableTypes(sample interface{}) []reflect.Type {
+	var types []reflect.Type
+	reachableTypes(reflect.TypeOf(sample), make(map[reflect.Type]bool), &types)
+	return types
+}
+
+func reachableTypes(t reflect.Type, seen map[reflect.Type]bool, types *[]reflect.Type) {
+	// composite types are visited once, so recursive types like
+	// type L []L terminate
+	if t == nil || seen[t] {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		seen[t] = true
+		reachableTypes(t.Elem(), seen, types)
+	case reflect.Map:
+		seen[t] = true
+		reachableTypes(t.Key(), seen, types)
+		reachableTypes(t.Elem(), seen, types)
+	case reflect.Struct:
+		seen[t] = true
+		*types = append(*types, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.PkgPath == "" || field.Anonymous {
+				reachableTypes(field.Type, seen, types)
+			}
+		}
+	}
+}
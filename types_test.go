@@ -0,0 +1,66 @@
+package structs
+
+import (
+	"reflect"
+	"testing"
+)
+
+type reachableNode struct {
+	Children []*reachableNode
+	Parent   *reachableNode
+}
+
+func TestReachableTypes(t *testing.T) {
+	type tag struct {
+		Name string
+	}
+
+	type hidden struct {
+		Name string
+	}
+
+	type address struct {
+		City string
+		Tags map[string]tag
+	}
+
+	type person struct {
+		Name      string
+		Addresses []address
+		Home      *address
+		Tree      reachableNode
+		private   hidden
+	}
+
+	expected := []reflect.Type{
+		reflect.TypeOf(person{}),
+		reflect.TypeOf(address{}),
+		reflect.TypeOf(tag{}),
+		reflect.TypeOf(reachableNode{}),
+	}
+
+	if types := ReachableTypes((*person)(nil)); !reflect.DeepEqual(types, expected) {
+		t.Errorf("ReachableTypes should return %v, got: %v", expected, types)
+	}
+}
+
+func TestReachableTypes_RecursiveTypes(t *testing.T) {
+	type item struct {
+		Name string
+	}
+
+	type list struct {
+		L recursiveSlice
+		M recursiveMap
+		I []item
+	}
+
+	expected := []reflect.Type{
+		reflect.TypeOf(list{}),
+		reflect.TypeOf(item{}),
+	}
+
+	if types := ReachableTypes(list{}); !reflect.DeepEqual(types, expected) {
+		t.Errorf("ReachableTypes should return %v for self-referencing slice and map types, got: %v", expected, types)
+	}
+}
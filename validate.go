@@ -0,0 +1,170 @@
+package structs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTag is returned by ValidateTags for malformed tags.
+var ErrInvalidTag = errors.New("invalid tag")
+
+// flagOptions are the tag options understood by the package which take no
+// value.
+var flagOptions = map[string]bool{
+	"omitempty":  true,
+	"keepempty":  true,
+	"omitnested": true,
+	"string":     true,
+	"flatten":    true,
+	"base64":     true,
+	"secret":     true,
+	"json":       true,
+	"labeled":    true,
+	"readonly":   true,
+}
+
+// valueOptions are the key=value tag options understood by the package.
+var valueOptions = map[string]bool{
+	"keyfrom":   true,
+	"as":        true,
+	"alias":     true,
+	"withlen":   true,
+	"precision": true,
+	"join":      true,
+	"order":     true,
+}
+
+// ValidateTags checks the tags of all fields, including the fields of
+// nested structs, for the TagName of s and returns an error for every
+// malformed tag, ie: empty, duplicate or unknown options, values given to
+// options which take none and options missing their value, as well as
+// tagged unexported fields, see TaggedButUnexported. Options are
+// known if they are built-in or listed in KnownOptions. Fields are referred
+// to by their dotted Go field names, ie: "Server.Port". Unknown key=value
+// options are allowed, ie: for GroupByOption, unless KnownOptions is set.
+func (s *Struct) ValidateTags() []error {
+	known := make(map[string]bool, len(s.KnownOptions))
+	for _, opt := range s.KnownOptions {
+		known[opt] = true
+	}
+
+	t := s.value.Type()
+	errs := s.validateTags(t, "", known, map[reflect.Type]bool{t: true})
+
+	for _, path := range s.TaggedButUnexported() {
+		errs = append(errs, fmt.Errorf("%s: %w: unexported field is ignored", path, ErrInvalidTag))
+	}
+
+	return errs
+}
+
+// TaggedButUnexported returns the dotted Go field names of the unexported
+// fields with a tag for the TagName of s, including the fields of nested
+// structs. Unexported fields are never converted, so their tags are most
+// likely a mistake. Embedded unexported structs, whose exported fields are
+// promoted, and fields tagged with "-" are not reported.
+func (s *Struct) TaggedButUnexported() []string {
+	t := s.value.Type()
+	return s.taggedButUnexported(t, "", map[reflect.Type]bool{t: true})
+}
+
+func (s *Struct) taggedButUnexported(t reflect.Type, prefix string, seen map[reflect.Type]bool) []string {
+	var paths []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, tagged := field.Tag.Lookup(s.TagName)
+		if tag == "-" {
+			continue
+		}
+
+		if field.PkgPath != "" && !(field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			if tagged {
+				paths = append(paths, joinPath(prefix, field.Name))
+			}
+			continue
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() != reflect.Struct || seen[ft] {
+			continue
+		}
+		seen[ft] = true
+
+		// the fields of embedded unexported structs are promoted
+		path := joinPath(prefix, field.Name)
+		if field.PkgPath != "" {
+			path = prefix
+		}
+		paths = append(paths, s.taggedButUnexported(ft, path, seen)...)
+	}
+
+	return paths
+}
+
+func (s *Struct) validateTags(t reflect.Type, prefix string, known map[string]bool, seen map[reflect.Type]bool) []error {
+	var errs []error
+
+	for _, field := range s.typeFields(t, t, nil) {
+		path := joinPath(prefix, field.Name)
+
+		_, tagOpts := s.parseTag(field)
+		opts := make(map[string]bool, len(tagOpts))
+
+		for _, opt := range tagOpts {
+			key, value, hasValue := strings.Cut(opt, "=")
+			unknown := !flagOptions[key] && !valueOptions[key] && !known[key] &&
+				(!hasValue || s.KnownOptions != nil)
+
+			var reason string
+			switch {
+			case opt == "":
+				reason = "empty option"
+			case opts[key]:
+				reason = fmt.Sprintf("duplicate option %q", key)
+			case flagOptions[key] && hasValue:
+				reason = fmt.Sprintf("option %q takes no value", key)
+			case valueOptions[key] && value == "":
+				reason = fmt.Sprintf("option %q requires a value", key)
+			case unknown:
+				reason = fmt.Sprintf("unknown option %q", key)
+			case key == "order":
+				if _, err := strconv.Atoi(value); err != nil {
+					reason = fmt.Sprintf("option %q requires an integer, got %q", key, value)
+				}
+			case key == "precision":
+				if n, err := strconv.Atoi(value); err != nil || n < 0 {
+					reason = fmt.Sprintf("option %q requires a non-negative integer, got %q", key, value)
+				}
+			case key == "keyfrom":
+				if _, ok := t.FieldByName(value); !ok {
+					reason = fmt.Sprintf("option %q refers to unknown field %q", key, value)
+				}
+			}
+
+			if reason != "" {
+				errs = append(errs, fmt.Errorf("%s: %w: %s", path, ErrInvalidTag, reason))
+			}
+			opts[key] = true
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if ft.Kind() == reflect.Struct && !seen[ft] {
+			seen[ft] = true
+			errs = append(errs, s.validateTags(ft, path, known, seen)...)
+		}
+	}
+
+	return errs
+}
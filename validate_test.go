@@ -0,0 +1,121 @@
+package structs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	type server struct {
+		Host string  `structs:"host,omitempty,omitempty"`
+		Port int     `structs:"port,keyfrom="`
+		Load float64 `structs:"load,precision=two"`
+	}
+
+	type config struct {
+		Name    string  `structs:"name,omitemtpy"`
+		Secret  string  `structs:"secret,secret=yes"`
+		Section string  `structs:"section,section=basic"`
+		Server  *server `structs:"server"`
+		Next    *config `structs:"next,omitempty"`
+	}
+
+	errs := New(config{}).ValidateTags()
+
+	expected := []string{
+		`Name: invalid tag: unknown option "omitemtpy"`,
+		`Secret: invalid tag: option "secret" takes no value`,
+		`Server.Host: invalid tag: duplicate option "omitempty"`,
+		`Server.Port: invalid tag: option "keyfrom" requires a value`,
+		`Server.Load: invalid tag: option "precision" requires a non-negative integer, got "two"`,
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("ValidateTags should return %d errors, got: %v", len(expected), errs)
+	}
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("ValidateTags should return ErrInvalidTag, got: %v", err)
+		}
+
+		if err.Error() != expected[i] {
+			t.Errorf("ValidateTags should return %q, got: %q", expected[i], err)
+		}
+	}
+
+	type valid struct {
+		Key   string  `structs:"key"`
+		Value string  `structs:"value,keyfrom=Key,omitempty"`
+		Price float64 `structs:"price,precision=2"`
+	}
+
+	if errs := New(valid{}).ValidateTags(); len(errs) != 0 {
+		t.Errorf("ValidateTags should return no errors for valid tags, got: %v", errs)
+	}
+}
+
+func TestValidateTags_KnownOptions(t *testing.T) {
+	type A struct {
+		Name    string `structs:"name,omitemtpy,required"`
+		Section string `structs:"section,section=basic"`
+		Group   string `structs:"group,gruop=admin"`
+	}
+
+	s := New(A{})
+	s.KnownOptions = []string{"required", "section"}
+
+	expected := []string{
+		`Name: invalid tag: unknown option "omitemtpy"`,
+		`Group: invalid tag: unknown option "gruop"`,
+	}
+
+	errs := s.ValidateTags()
+	if len(errs) != len(expected) {
+		t.Fatalf("ValidateTags should return %d errors, got: %v", len(expected), errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("ValidateTags should return %q, got: %q", expected[i], err)
+		}
+	}
+}
+
+func TestTaggedButUnexported(t *testing.T) {
+	type server struct {
+		Host string `structs:"host"`
+		port int    `structs:"port"`
+	}
+
+	type base struct {
+		ID      int    `structs:"id"`
+		version string `structs:"version"`
+	}
+
+	type A struct {
+		Name    string `structs:"name"`
+		secret  string `structs:"secret"`
+		ignored string `structs:"-"`
+		plain   string
+		base    `structs:",flatten"`
+		Server  *server `structs:"server"`
+	}
+
+	expected := []string{"secret", "version", "Server.port"}
+
+	s := New(A{})
+	if paths := s.TaggedButUnexported(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("TaggedButUnexported should return %v, got: %v", expected, paths)
+	}
+
+	errs := s.ValidateTags()
+	if len(errs) != len(expected) {
+		t.Fatalf("ValidateTags should return %d errors, got: %v", len(expected), errs)
+	}
+
+	if msg := `secret: invalid tag: unexported field is ignored`; errs[0].Error() != msg {
+		t.Errorf("ValidateTags should return %q, got: %q", msg, errs[0])
+	}
+}